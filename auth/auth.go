@@ -35,12 +35,15 @@ import (
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/infra"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/vars"
 	"github.com/googleapis/gax-go/v2"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/oauth"
+	"google.golang.org/grpc/status"
 	authenticationv1 "k8s.io/api/authentication/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -50,10 +53,22 @@ import (
 const cloudScope = "https://www.googleapis.com/auth/cloud-platform"
 
 type Client struct {
-	KubeClient     *kubernetes.Clientset
+	KubeClient     kubernetes.Interface
 	MetadataClient *metadata.Client
 	IAMClient      *credentials.IamCredentialsClient
 	HTTPClient     *http.Client
+	// TokenCache caches the workload identity tokens across mounts. A nil
+	// cache disables caching.
+	TokenCache *TokenCache
+	// Limiter bounds the concurrency and rate of the STS and IAM Credentials
+	// calls across mounts. A nil Limiter does not limit calls.
+	Limiter *infra.Limiter
+	// RetryPolicy retries the STS and IAM Credentials calls failing with
+	// transient errors. A nil RetryPolicy makes a single attempt.
+	RetryPolicy *infra.RetryPolicy
+
+	// now is replaced in unit tests.
+	now func() time.Time
 }
 
 // JSON key file types.
@@ -83,11 +98,21 @@ func (c *Client) TokenSource(ctx context.Context, cfg *config.MountConfig) (oaut
 		if err != nil {
 			return nil, fmt.Errorf("unable to generate credentials from key.json: %w", err)
 		}
+		if err := checkUniverseDomain(creds); err != nil {
+			return nil, err
+		}
 		return creds.TokenSource, nil
 	}
 
 	if cfg.AuthProviderADC {
-		return google.DefaultTokenSource(ctx, cloudScope)
+		creds, err := google.FindDefaultCredentials(ctx, cloudScope)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkUniverseDomain(creds); err != nil {
+			return nil, err
+		}
+		return creds.TokenSource, nil
 	}
 
 	if cfg.AuthPodADC {
@@ -101,6 +126,23 @@ func (c *Client) TokenSource(ctx context.Context, cfg *config.MountConfig) (oaut
 	return nil, errors.New("mount configuration has no auth method configured")
 }
 
+// checkUniverseDomain returns an error if the credentials belong to another
+// universe than the one the provider is configured for.
+func checkUniverseDomain(creds *google.Credentials) error {
+	want, err := vars.UniverseDomain.GetValue()
+	if err != nil {
+		return fmt.Errorf("unable to read universe domain from environment: %w", err)
+	}
+	got, err := creds.GetUniverseDomain()
+	if err != nil {
+		return fmt.Errorf("unable to determine universe domain of credentials: %w", err)
+	}
+	if got != want {
+		return fmt.Errorf("credentials universe domain %q does not match configured universe domain %q", got, want)
+	}
+	return nil
+}
+
 // Token fetches a workload identity auth token for the pod for the MountConfig.
 //
 // This requires obtaining a ServiceAccount token from the K8S API for the pod,
@@ -110,9 +152,9 @@ func (c *Client) TokenSource(ctx context.Context, cfg *config.MountConfig) (oaut
 //
 // Caveats:
 //
-// None of the API calls are cached since the plugin binary is executed once per
-// mount event. The tokens are to be used immediately so no refresh abilities are
-// implemented - blocking Issue #14.
+// The resulting token is cached in the TokenCache (if configured) keyed by the
+// K8S service account and its GCP service account annotations, so only the
+// service account is read from the K8S API while a cached token is valid.
 //
 // This method requires additional K8S API permission for the CSI driver
 // daemonset, including serviceaccounts/token create and serviceaccounts get.
@@ -155,6 +197,24 @@ func (c *Client) Token(ctx context.Context, cfg *config.MountConfig) (*oauth2.To
 	gcpSA := saResp.Annotations["iam.gke.io/gcp-service-account"]
 	klog.V(5).InfoS("matched service account", "service_account", gcpSA)
 
+	var delegates []string
+	if gcpSADelegates, ok := saResp.Annotations["iam.gke.io/gcp-service-account-delegates"]; ok && gcpSA != "" {
+		if err := json.Unmarshal([]byte(gcpSADelegates), &delegates); err != nil {
+			return nil, fmt.Errorf("unable to parse delegates annotation on SA: %w", err)
+		}
+
+		klog.V(5).InfoS("matched service account delegates", "service_account_delegates", delegates)
+	}
+
+	cacheKey := newTokenCacheKey(audience, cfg.PodInfo.Namespace, cfg.PodInfo.ServiceAccount, gcpSA, delegates)
+	return c.TokenCache.do(cacheKey, func() (*oauth2.Token, error) {
+		return c.exchangeToken(ctx, cfg, idPool, audience, gcpSA, delegates)
+	})
+}
+
+// exchangeToken trades a serviceaccount token of the pod for an
+// identitybindingtoken, and that for a token of gcpSA if it is set.
+func (c *Client) exchangeToken(ctx context.Context, cfg *config.MountConfig, idPool, audience, gcpSA string, delegates []string) (*oauth2.Token, error) {
 	// Obtain a serviceaccount token for the pod.
 	var saTokenVal string
 	if cfg.PodInfo.ServiceAccountTokens != "" {
@@ -172,7 +232,16 @@ func (c *Client) Token(ctx context.Context, cfg *config.MountConfig) (*oauth2.To
 	}
 
 	// Trade the kubernetes token for an identitybindingtoken token.
-	idBindToken, err := tradeIDBindToken(ctx, c.HTTPClient, saTokenVal, audience)
+	var idBindToken *oauth2.Token
+	err := c.RetryPolicy.Do(ctx, "IdentityBindingToken", func() error {
+		release, err := c.Limiter.Acquire(ctx, infra.APISTS)
+		if err != nil {
+			return err
+		}
+		defer release()
+		idBindToken, err = tradeIDBindToken(ctx, c.HTTPClient, saTokenVal, audience, c.clock())
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("unable to fetch identitybindingtoken: %w", err)
 	}
@@ -188,25 +257,39 @@ func (c *Client) Token(ctx context.Context, cfg *config.MountConfig) (*oauth2.To
 		Name:  fmt.Sprintf("projects/-/serviceAccounts/%s", gcpSA),
 		Scope: secretmanager.DefaultAuthScopes(),
 	}
-
-	if gcpSADelegates, ok := saResp.Annotations["iam.gke.io/gcp-service-account-delegates"]; ok {
-		var delegates []string
-		if err := json.Unmarshal([]byte(gcpSADelegates), &delegates); err != nil {
-			return nil, fmt.Errorf("unable to parse delegates annotation on SA: %w", err)
-		}
-
-		klog.V(5).InfoS("matched service account delegates", "service_account_delegates", delegates)
-
-		for _, delegate := range delegates {
-			req.Delegates = append(req.Delegates, fmt.Sprintf("projects/-/serviceAccounts/%s", delegate))
-		}
+	for _, delegate := range delegates {
+		req.Delegates = append(req.Delegates, fmt.Sprintf("projects/-/serviceAccounts/%s", delegate))
 	}
 
-	gcpSAResp, err := c.IAMClient.GenerateAccessToken(ctx, req, gax.WithGRPCOptions(grpc.PerRPCCredentials(oauth.TokenSource{TokenSource: oauth2.StaticTokenSource(idBindToken)})))
+	callOptions := []gax.CallOption{gax.WithGRPCOptions(grpc.PerRPCCredentials(oauth.TokenSource{TokenSource: oauth2.StaticTokenSource(idBindToken)}))}
+	if c.RetryPolicy != nil {
+		callOptions = append(callOptions, infra.WithoutSDKRetries)
+	}
+	var gcpSAResp *credentialspb.GenerateAccessTokenResponse
+	err = c.RetryPolicy.Do(ctx, "GenerateAccessToken", func() error {
+		release, err := c.Limiter.Acquire(ctx, infra.APIIAMCredentials)
+		if err != nil {
+			return err
+		}
+		defer release()
+		gcpSAResp, err = c.IAMClient.GenerateAccessToken(ctx, req, callOptions...)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("unable to fetch gcp service account token: %w", err)
 	}
-	return &oauth2.Token{AccessToken: gcpSAResp.GetAccessToken()}, nil
+	token := &oauth2.Token{AccessToken: gcpSAResp.GetAccessToken()}
+	if gcpSAResp.GetExpireTime() != nil {
+		token.Expiry = gcpSAResp.GetExpireTime().AsTime()
+	}
+	return token, nil
+}
+
+func (c *Client) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
 }
 
 func (c *Client) extractSAToken(cfg *config.MountConfig, idPool, audience string) (*authenticationv1.TokenRequestStatus, error) {
@@ -287,7 +370,7 @@ func (c *Client) gkeWorkloadIdentity(ctx context.Context, cfg *config.MountConfi
 		}
 	}
 
-	gkeWorkloadIdentityProviderEndpoint, err := vars.GkeWorkloadIdentityEndPoint.GetValue()
+	gkeWorkloadIdentityProviderEndpoint, err := vars.GkeWorkloadIdentityEndPoint.GetUniverseValue()
 	if err != nil {
 		return "", "", fmt.Errorf("unable to read GKE workload identity provider endpoint: %w", err)
 	}
@@ -328,7 +411,7 @@ func (c *Client) fleetWorkloadIdentity(ctx context.Context, cfg *config.MountCon
 	return idPool, idProvider, "", nil
 }
 
-func tradeIDBindToken(ctx context.Context, client *http.Client, k8sToken, audience string) (*oauth2.Token, error) {
+func tradeIDBindToken(ctx context.Context, client *http.Client, k8sToken, audience string, now time.Time) (*oauth2.Token, error) {
 	body, err := json.Marshal(map[string]string{
 		"grant_type":           "urn:ietf:params:oauth:grant-type:token-exchange",
 		"subject_token_type":   "urn:ietf:params:oauth:token-type:jwt",
@@ -341,7 +424,7 @@ func tradeIDBindToken(ctx context.Context, client *http.Client, k8sToken, audien
 		return nil, err
 	}
 
-	identityBindingTokenEndPoint, err := vars.IdentityBindingTokenEndPoint.GetValue()
+	identityBindingTokenEndPoint, err := vars.IdentityBindingTokenEndPoint.GetUniverseValue()
 
 	if err != nil {
 		return nil, fmt.Errorf("unable to read identity binding token endpoint: %w", err)
@@ -356,14 +439,16 @@ func tradeIDBindToken(ctx context.Context, client *http.Client, k8sToken, audien
 	gcpIamMetricRecorder := csrmetrics.OutboundRPCStartRecorder("gcp_iam_get_id_bind_token_requests")
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		// connection failures are transient and retried like unavailable
+		// API responses.
+		return nil, status.Error(codes.Unavailable, err.Error())
 	}
+	defer resp.Body.Close()
 	gcpIamMetricRecorder(csrmetrics.OutboundRPCStatus(strconv.Itoa(resp.StatusCode)))
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("could not get idbindtoken token, status: %v", resp.StatusCode)
+		return nil, status.Errorf(infra.HTTPStatusCode(resp.StatusCode), "could not get idbindtoken token, status: %v", resp.StatusCode)
 	}
 
-	defer resp.Body.Close()
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -373,5 +458,8 @@ func tradeIDBindToken(ctx context.Context, client *http.Client, k8sToken, audien
 	if err := json.Unmarshal(respBody, idBindToken); err != nil {
 		return nil, err
 	}
+	if idBindToken.ExpiresIn > 0 {
+		idBindToken.Expiry = now.Add(time.Duration(idBindToken.ExpiresIn) * time.Second)
+	}
 	return idBindToken, nil
 }
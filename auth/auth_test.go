@@ -0,0 +1,431 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	credentials "cloud.google.com/go/iam/credentials/apiv1"
+	"cloud.google.com/go/iam/credentials/apiv1/credentialspb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/local"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeTokenServers serves the STS and IAM Credentials token exchanges,
+// counting the tokens minted by each.
+type fakeTokenServers struct {
+	credentialspb.UnimplementedIAMCredentialsServer
+
+	now          func() time.Time
+	stsExpiresIn int64
+	iamExpiresIn time.Duration
+	stsCalls     int
+	iamCalls     int
+}
+
+func (f *fakeTokenServers) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	f.stsCalls++
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": fmt.Sprintf("sts-%d", f.stsCalls),
+		"token_type":   "Bearer",
+		"expires_in":   f.stsExpiresIn,
+	})
+}
+
+func (f *fakeTokenServers) GenerateAccessToken(_ context.Context, req *credentialspb.GenerateAccessTokenRequest) (*credentialspb.GenerateAccessTokenResponse, error) {
+	f.iamCalls++
+	resp := &credentialspb.GenerateAccessTokenResponse{AccessToken: fmt.Sprintf("%s-%d", req.GetName(), f.iamCalls)}
+	if f.iamExpiresIn > 0 {
+		resp.ExpireTime = timestamppb.New(f.now().Add(f.iamExpiresIn))
+	}
+	return resp, nil
+}
+
+// mockIAMClient builds an IamCredentialsClient talking to a GRPC server of f
+// on a unix socket, whose local credentials allow the token of the
+// identitybindingtoken to be sent.
+func mockIAMClient(t testing.TB, f *fakeTokenServers) *credentials.IamCredentialsClient {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "iam.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := grpc.NewServer(grpc.Creds(local.NewCredentials()))
+	credentialspb.RegisterIAMCredentialsServer(s, f)
+	go s.Serve(l)
+
+	conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(local.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	client, err := credentials.NewIamCredentialsClient(context.Background(), option.WithoutAuthentication(), option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		s.GracefulStop()
+	})
+	return client
+}
+
+func testMountConfig(serviceAccount string) *config.MountConfig {
+	return &config.MountConfig{
+		AuthPodADC: true,
+		PodInfo: &config.PodInfo{
+			Namespace:            "default",
+			Name:                 "mypod",
+			UID:                  "123",
+			ServiceAccount:       serviceAccount,
+			ServiceAccountTokens: `{"project.svc.id.goog": {"token": "k8s-token"}}`,
+		},
+	}
+}
+
+func TestToken(t *testing.T) {
+	t.Setenv("PROJECT", "project")
+	t.Setenv("CLUSTER_LOCATION", "us-central1")
+	t.Setenv("CLUSTER_NAME", "cluster")
+
+	const gsa = "gsa@project.iam.gserviceaccount.com"
+	tests := []struct {
+		name          string
+		gcpSA         string
+		stsExpiresIn  int64
+		iamExpiresIn  time.Duration
+		elapsed       time.Duration
+		wantFirst     string
+		wantSecond    string
+		wantKubeCalls int
+		wantSTSCalls  int
+		wantIAMCalls  int
+	}{
+		{
+			name:          "identity binding token hit",
+			stsExpiresIn:  3600,
+			elapsed:       30 * time.Minute,
+			wantFirst:     "sts-1",
+			wantSecond:    "sts-1",
+			wantKubeCalls: 2,
+			wantSTSCalls:  1,
+		},
+		{
+			name:          "identity binding token refreshed before expiry",
+			stsExpiresIn:  3600,
+			elapsed:       time.Hour - tokenRefreshBefore,
+			wantFirst:     "sts-1",
+			wantSecond:    "sts-2",
+			wantKubeCalls: 2,
+			wantSTSCalls:  2,
+		},
+		{
+			name:          "identity binding token without expires_in",
+			elapsed:       time.Second,
+			wantFirst:     "sts-1",
+			wantSecond:    "sts-2",
+			wantKubeCalls: 2,
+			wantSTSCalls:  2,
+		},
+		{
+			name:          "service account token hit",
+			gcpSA:         gsa,
+			stsExpiresIn:  3600,
+			iamExpiresIn:  time.Hour,
+			elapsed:       30 * time.Minute,
+			wantFirst:     "projects/-/serviceAccounts/" + gsa + "-1",
+			wantSecond:    "projects/-/serviceAccounts/" + gsa + "-1",
+			wantKubeCalls: 2,
+			wantSTSCalls:  1,
+			wantIAMCalls:  1,
+		},
+		{
+			name:          "service account token refreshed before expiry",
+			gcpSA:         gsa,
+			stsExpiresIn:  3600,
+			iamExpiresIn:  10 * time.Minute,
+			elapsed:       5 * time.Minute,
+			wantFirst:     "projects/-/serviceAccounts/" + gsa + "-1",
+			wantSecond:    "projects/-/serviceAccounts/" + gsa + "-2",
+			wantKubeCalls: 2,
+			wantSTSCalls:  2,
+			wantIAMCalls:  2,
+		},
+		{
+			name:          "service account token without expire time",
+			gcpSA:         gsa,
+			stsExpiresIn:  3600,
+			elapsed:       time.Second,
+			wantFirst:     "projects/-/serviceAccounts/" + gsa + "-1",
+			wantSecond:    "projects/-/serviceAccounts/" + gsa + "-2",
+			wantKubeCalls: 2,
+			wantSTSCalls:  2,
+			wantIAMCalls:  2,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			clock := func() time.Time { return now }
+
+			f := &fakeTokenServers{now: clock, stsExpiresIn: tc.stsExpiresIn, iamExpiresIn: tc.iamExpiresIn}
+			sts := httptest.NewServer(f)
+			defer sts.Close()
+			t.Setenv("GAIA_TOKEN_EXCHANGE_ENDPOINT", sts.URL)
+
+			sa := &corev1.ServiceAccount{ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "ksa"}}
+			if tc.gcpSA != "" {
+				sa.Annotations = map[string]string{"iam.gke.io/gcp-service-account": tc.gcpSA}
+			}
+			kube := fake.NewClientset(sa)
+			cache := NewTokenCache()
+			cache.now = clock
+			c := &Client{
+				KubeClient: kube,
+				IAMClient:  mockIAMClient(t, f),
+				HTTPClient: sts.Client(),
+				TokenCache: cache,
+				now:        clock,
+			}
+
+			got, err := c.Token(context.Background(), testMountConfig("ksa"))
+			if err != nil {
+				t.Fatalf("Token() got err = %v, want err = nil", err)
+			}
+			if got.AccessToken != tc.wantFirst {
+				t.Errorf("Token() got token = %q, want %q", got.AccessToken, tc.wantFirst)
+			}
+			now = now.Add(tc.elapsed)
+			got, err = c.Token(context.Background(), testMountConfig("ksa"))
+			if err != nil {
+				t.Fatalf("Token() got err = %v, want err = nil", err)
+			}
+			if got.AccessToken != tc.wantSecond {
+				t.Errorf("Token() got token = %q, want %q", got.AccessToken, tc.wantSecond)
+			}
+
+			if got := len(kube.Actions()); got != tc.wantKubeCalls {
+				t.Errorf("Token() made %d kube API calls, want %d", got, tc.wantKubeCalls)
+			}
+			if f.stsCalls != tc.wantSTSCalls {
+				t.Errorf("Token() made %d STS calls, want %d", f.stsCalls, tc.wantSTSCalls)
+			}
+			if f.iamCalls != tc.wantIAMCalls {
+				t.Errorf("Token() made %d IAM calls, want %d", f.iamCalls, tc.wantIAMCalls)
+			}
+		})
+	}
+}
+
+func TestTokenServiceAccountIsolation(t *testing.T) {
+	t.Setenv("PROJECT", "project")
+	t.Setenv("CLUSTER_LOCATION", "us-central1")
+	t.Setenv("CLUSTER_NAME", "cluster")
+
+	f := &fakeTokenServers{now: time.Now, stsExpiresIn: 3600}
+	sts := httptest.NewServer(f)
+	defer sts.Close()
+	t.Setenv("GAIA_TOKEN_EXCHANGE_ENDPOINT", sts.URL)
+
+	c := &Client{
+		KubeClient: fake.NewClientset(
+			&corev1.ServiceAccount{ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "a"}},
+			&corev1.ServiceAccount{ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "b"}},
+		),
+		HTTPClient: sts.Client(),
+		TokenCache: NewTokenCache(),
+	}
+	tokens := map[string]string{}
+	for _, ksa := range []string{"a", "b", "a", "b"} {
+		got, err := c.Token(context.Background(), testMountConfig(ksa))
+		if err != nil {
+			t.Fatalf("Token(%s) got err = %v, want err = nil", ksa, err)
+		}
+		if want, ok := tokens[ksa]; ok && got.AccessToken != want {
+			t.Errorf("Token(%s) got token = %q, want cached %q", ksa, got.AccessToken, want)
+		}
+		tokens[ksa] = got.AccessToken
+	}
+	if tokens["a"] == tokens["b"] {
+		t.Errorf("Token() returned the same token %q for different service accounts", tokens["a"])
+	}
+	if f.stsCalls != 2 {
+		t.Errorf("Token() made %d STS calls, want 2", f.stsCalls)
+	}
+}
+
+func TestTokenAnnotationChange(t *testing.T) {
+	t.Setenv("PROJECT", "project")
+	t.Setenv("CLUSTER_LOCATION", "us-central1")
+	t.Setenv("CLUSTER_NAME", "cluster")
+
+	f := &fakeTokenServers{now: time.Now, stsExpiresIn: 3600, iamExpiresIn: time.Hour}
+	sts := httptest.NewServer(f)
+	defer sts.Close()
+	t.Setenv("GAIA_TOKEN_EXCHANGE_ENDPOINT", sts.URL)
+
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "ksa",
+			Annotations: map[string]string{"iam.gke.io/gcp-service-account": "privileged@project.iam.gserviceaccount.com"},
+		},
+	}
+	kube := fake.NewClientset(sa)
+	c := &Client{
+		KubeClient: kube,
+		IAMClient:  mockIAMClient(t, f),
+		HTTPClient: sts.Client(),
+		TokenCache: NewTokenCache(),
+	}
+
+	for _, tc := range []struct {
+		annotations map[string]string
+		want        string
+	}{
+		{
+			annotations: sa.Annotations,
+			want:        "projects/-/serviceAccounts/privileged@project.iam.gserviceaccount.com-1",
+		},
+		{
+			annotations: map[string]string{
+				"iam.gke.io/gcp-service-account":           "privileged@project.iam.gserviceaccount.com",
+				"iam.gke.io/gcp-service-account-delegates": `["delegate@project.iam.gserviceaccount.com"]`,
+			},
+			want: "projects/-/serviceAccounts/privileged@project.iam.gserviceaccount.com-2",
+		},
+		{
+			annotations: map[string]string{"iam.gke.io/gcp-service-account": "restricted@project.iam.gserviceaccount.com"},
+			want:        "projects/-/serviceAccounts/restricted@project.iam.gserviceaccount.com-3",
+		},
+		{
+			want: "sts-4",
+		},
+	} {
+		sa.Annotations = tc.annotations
+		if _, err := kube.CoreV1().ServiceAccounts("default").Update(context.Background(), sa, v1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Token(context.Background(), testMountConfig("ksa"))
+		if err != nil {
+			t.Fatalf("Token() got err = %v, want err = nil", err)
+		}
+		if got.AccessToken != tc.want {
+			t.Errorf("Token() with annotations %v got token = %q, want %q", tc.annotations, got.AccessToken, tc.want)
+		}
+	}
+}
+
+// serviceAccountKey returns a key.json of a service account, in universe
+// unless it is empty.
+func serviceAccountKey(t testing.TB, universe string) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := map[string]string{
+		"type":           "service_account",
+		"project_id":     "project",
+		"private_key_id": "1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "gsa@project.iam.gserviceaccount.com",
+		"client_id":      "1",
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	}
+	if universe != "" {
+		file["universe_domain"] = universe
+	}
+	b, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestTokenSourceNodePublishSecretUniverseDomain(t *testing.T) {
+	tests := []struct {
+		name           string
+		keyUniverse    string
+		universeDomain string
+		wantErr        string
+	}{
+		{
+			name: "default universe",
+		},
+		{
+			name:           "matching universe",
+			keyUniverse:    "example.com",
+			universeDomain: "example.com",
+		},
+		{
+			name:        "key of another universe",
+			keyUniverse: "example.com",
+			wantErr:     `credentials universe domain "example.com" does not match configured universe domain "googleapis.com"`,
+		},
+		{
+			name:           "key of the default universe",
+			universeDomain: "example.com",
+			wantErr:        `credentials universe domain "googleapis.com" does not match configured universe domain "example.com"`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ALLOW_NODE_PUBLISH_SECRET", "true")
+			if tc.universeDomain != "" {
+				t.Setenv("UNIVERSE_DOMAIN", tc.universeDomain)
+			}
+			cfg := &config.MountConfig{
+				AuthNodePublishSecret: true,
+				AuthKubeSecret:        serviceAccountKey(t, tc.keyUniverse),
+				PodInfo:               &config.PodInfo{Namespace: "default", Name: "mypod"},
+			}
+
+			ts, err := (&Client{}).TokenSource(context.Background(), cfg)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("TokenSource() got err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || ts == nil {
+				t.Errorf("TokenSource() got %v, %v, want a token source", ts, err)
+			}
+		})
+	}
+}
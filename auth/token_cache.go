@@ -0,0 +1,162 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"golang.org/x/oauth2"
+)
+
+const (
+	tokenCacheMetricName = "workload_identity_token"
+
+	// tokenRefreshBefore is how long before their expiry cached tokens are
+	// no longer handed out, so that a token is never used close to its
+	// expiry and a fresh one is obtained ahead of time.
+	tokenRefreshBefore = 5 * time.Minute
+)
+
+// TokenCache caches workload identity access tokens across mounts.
+//
+// Tokens are keyed by the workload identity audience, the Kubernetes service
+// account and the GCP service account and delegates of its iam.gke.io
+// annotations, so that a change to the annotations takes effect on the next
+// mount. Concurrent misses of the same key are collapsed into a single token
+// exchange.
+type TokenCache struct {
+	mu       sync.Mutex
+	tokens   map[tokenCacheKey]*oauth2.Token
+	inflight map[tokenCacheKey]*tokenFetch
+
+	// now is replaced in unit tests.
+	now func() time.Time
+}
+
+type tokenCacheKey struct {
+	audience          string
+	namespace         string
+	serviceAccount    string
+	gcpServiceAccount string
+	delegates         string
+}
+
+func newTokenCacheKey(audience, namespace, serviceAccount, gcpServiceAccount string, delegates []string) tokenCacheKey {
+	return tokenCacheKey{
+		audience:          audience,
+		namespace:         namespace,
+		serviceAccount:    serviceAccount,
+		gcpServiceAccount: gcpServiceAccount,
+		delegates:         strings.Join(delegates, ","),
+	}
+}
+
+type tokenFetch struct {
+	done  chan struct{}
+	token *oauth2.Token
+	err   error
+}
+
+// NewTokenCache returns an empty TokenCache.
+func NewTokenCache() *TokenCache {
+	return &TokenCache{
+		tokens:   make(map[tokenCacheKey]*oauth2.Token),
+		inflight: make(map[tokenCacheKey]*tokenFetch),
+		now:      time.Now,
+	}
+}
+
+// do returns the cached token for key, or the token returned by fetch, which
+// is called by the first of the concurrent callers missing key only. A nil
+// TokenCache calls fetch every time.
+func (c *TokenCache) do(key tokenCacheKey, fetch func() (*oauth2.Token, error)) (*oauth2.Token, error) {
+	if c == nil {
+		return fetch()
+	}
+	if token, ok := c.get(key); ok {
+		return token, nil
+	}
+	c.mu.Lock()
+	// The token may have been added since get.
+	if token, ok := c.tokens[key]; ok && c.fresh(token) {
+		c.mu.Unlock()
+		return token, nil
+	}
+	if f, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-f.done
+		return f.token, f.err
+	}
+	f := &tokenFetch{done: make(chan struct{})}
+	c.inflight[key] = f
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		close(f.done)
+	}()
+	f.token, f.err = fetch()
+	if f.err == nil {
+		c.add(key, f.token)
+	}
+	return f.token, f.err
+}
+
+// get returns the cached token for key if it is not close to its expiry.
+func (c *TokenCache) get(key tokenCacheKey) (*oauth2.Token, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, ok := c.tokens[key]
+	if ok && !c.fresh(token) {
+		delete(c.tokens, key)
+		ok = false
+	}
+	if !ok {
+		csrmetrics.RecordCacheLookup(tokenCacheMetricName, csrmetrics.CacheMiss)
+		return nil, false
+	}
+	csrmetrics.RecordCacheLookup(tokenCacheMetricName, csrmetrics.CacheHit)
+	return token, true
+}
+
+// add stores token for key. Tokens without an expiry are not cached.
+func (c *TokenCache) add(key tokenCacheKey, token *oauth2.Token) {
+	if c == nil || token.Expiry.IsZero() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop tokens of service accounts that are no longer mounted.
+	for k, t := range c.tokens {
+		if !c.fresh(t) {
+			delete(c.tokens, k)
+		}
+	}
+	c.tokens[key] = token
+}
+
+func (c *TokenCache) fresh(token *oauth2.Token) bool {
+	return c.now().Add(tokenRefreshBefore).Before(token.Expiry)
+}
@@ -0,0 +1,147 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTokenCache(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	key := newTokenCacheKey("audience", "default", "ksa", "", nil)
+
+	tests := []struct {
+		name    string
+		expiry  time.Time
+		elapsed time.Duration
+		wantHit bool
+	}{
+		{
+			name:    "hit",
+			expiry:  start.Add(time.Hour),
+			elapsed: 30 * time.Minute,
+			wantHit: true,
+		},
+		{
+			name:    "refreshed before expiry",
+			expiry:  start.Add(time.Hour),
+			elapsed: time.Hour - tokenRefreshBefore,
+			wantHit: false,
+		},
+		{
+			name:    "expired",
+			expiry:  start.Add(time.Hour),
+			elapsed: 2 * time.Hour,
+			wantHit: false,
+		},
+		{
+			name:    "no expiry",
+			elapsed: time.Minute,
+			wantHit: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			now := start
+			c := NewTokenCache()
+			c.now = func() time.Time { return now }
+
+			c.add(key, &oauth2.Token{AccessToken: "token", Expiry: tc.expiry})
+			now = now.Add(tc.elapsed)
+			got, ok := c.get(key)
+			if ok != tc.wantHit {
+				t.Fatalf("get() got hit = %v, want %v", ok, tc.wantHit)
+			}
+			if ok && got.AccessToken != "token" {
+				t.Errorf("get() got token = %q, want %q", got.AccessToken, "token")
+			}
+		})
+	}
+}
+
+func TestTokenCacheKeys(t *testing.T) {
+	c := NewTokenCache()
+	expiry := time.Now().Add(time.Hour)
+	c.add(newTokenCacheKey("audience", "default", "ksa", "", nil), &oauth2.Token{AccessToken: "default/ksa", Expiry: expiry})
+
+	for _, key := range []tokenCacheKey{
+		newTokenCacheKey("audience", "other", "ksa", "", nil),
+		newTokenCacheKey("audience", "default", "other", "", nil),
+		newTokenCacheKey("other", "default", "ksa", "", nil),
+		newTokenCacheKey("audience", "default", "ksa", "gsa@project.iam.gserviceaccount.com", nil),
+		newTokenCacheKey("audience", "default", "ksa", "gsa@project.iam.gserviceaccount.com", []string{"delegate@project.iam.gserviceaccount.com"}),
+	} {
+		if got, ok := c.get(key); ok {
+			t.Errorf("get(%v) got token = %q, want miss", key, got.AccessToken)
+		}
+	}
+	if got, ok := c.get(newTokenCacheKey("audience", "default", "ksa", "", nil)); !ok || got.AccessToken != "default/ksa" {
+		t.Errorf("get() got token = %v, %v, want default/ksa", got, ok)
+	}
+}
+
+func TestTokenCacheNil(t *testing.T) {
+	var c *TokenCache
+	key := newTokenCacheKey("audience", "default", "ksa", "", nil)
+	c.add(key, &oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)})
+	if _, ok := c.get(key); ok {
+		t.Errorf("get() on nil cache got hit, want miss")
+	}
+}
+
+func TestTokenCacheDo(t *testing.T) {
+	c := NewTokenCache()
+	key := newTokenCacheKey("audience", "default", "ksa", "", nil)
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	fetch := func() (*oauth2.Token, error) {
+		fetches.Add(1)
+		<-release
+		return &oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}, nil
+	}
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := c.do(key, fetch)
+			if err != nil || got.AccessToken != "token" {
+				t.Errorf("do() got %v, %v, want token", got, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("do() fetched %d tokens for concurrent misses, want 1", got)
+	}
+
+	// Errors are returned to the waiting callers but not cached.
+	other := newTokenCacheKey("audience", "default", "other", "", nil)
+	if _, err := c.do(other, func() (*oauth2.Token, error) { return nil, errors.New("failed") }); err == nil {
+		t.Errorf("do() got err = nil, want error")
+	}
+	if _, ok := c.get(other); ok {
+		t.Errorf("get() got hit after failed fetch, want miss")
+	}
+}
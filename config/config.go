@@ -21,6 +21,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/vars"
 	"gopkg.in/yaml.v3"
@@ -40,7 +44,12 @@ const (
 // secret resource name to a path in the filesystem.
 type Secret struct {
 	// ResourceName refers to a SecretVersion in the format
-	// projects/*/secrets/*/versions/*.
+	// projects/*/secrets/*/versions/*, a ParameterVersion, a Cloud Storage
+	// object in the format gs://<bucket>/<object>[#<generation>] or a CA pool
+	// issuing a certificate, see Certificate. Secret and parameter versions
+	// may be given in the short forms <secret>[@<version>|:<version>] and
+	// parameters/<parameter>@<version>, which are expanded with the project
+	// and location attributes of the SecretProviderClass.
 	ResourceName string `json:"resourceName" yaml:"resourceName"`
 
 	// FileName is where the contents of the secret are to be written.
@@ -52,9 +61,152 @@ type Secret struct {
 	ExtractJSONKey string `json:"extractJSONKey" yaml:"extractJSONKey"`
 	ExtractYAMLKey string `json:"extractYAMLKey" yaml:"extractYAMLKey"`
 
+	// ExtractJSONPath and ExtractYAMLPath select a nested value of the
+	// payload using dot and bracket notation, e.g. "hosts[0].cert".
+	ExtractJSONPath string `json:"extractJSONPath" yaml:"extractJSONPath"`
+	ExtractYAMLPath string `json:"extractYAMLPath" yaml:"extractYAMLPath"`
+
+	// ExtractAll writes every top-level key of a JSON or YAML payload to its
+	// own file in the directory given by FileName or Path.
+	ExtractAll bool `json:"extractAll" yaml:"extractAll"`
+
+	// Keys writes the selected values of a JSON or YAML payload to their own
+	// files in the directory given by FileName or Path.
+	Keys []*SecretKey `json:"keys" yaml:"keys"`
+
 	// Mode is the optional file mode for the file containing the secret. Must be
 	// an octal value between 0000 and 0777 or a decimal value between 0 and 511
 	Mode *int32 `json:"mode,omitempty" yaml:"mode,omitempty"`
+
+	// Decode decodes the payload after key extraction. One of base64,
+	// base64url, hex or gzip.
+	Decode string `json:"decode" yaml:"decode"`
+
+	// KMSDecrypt is a Cloud KMS CryptoKey in the format
+	// projects/*/locations/*/keyRings/*/cryptoKeys/*. The payload is
+	// decrypted with it after key extraction and decoding.
+	KMSDecrypt string `json:"kmsDecrypt" yaml:"kmsDecrypt"`
+
+	// Optional secrets which do not exist or cannot be accessed do not fail
+	// the mount. Their file is left out, or contains Default if it is set.
+	Optional bool    `json:"optional" yaml:"optional"`
+	Default  *string `json:"default,omitempty" yaml:"default,omitempty"`
+
+	// Alias names the payload of the secret in the templates of the mount.
+	Alias string `json:"alias" yaml:"alias"`
+
+	// Template makes the entry a file rendered with text/template from the
+	// payloads of the other entries, keyed by their Alias. Template entries
+	// have no ResourceName.
+	Template string `json:"template" yaml:"template"`
+
+	// Format renders the entry in the given format. With "dotenv" the
+	// extracted keys, or all top-level keys of a JSON or YAML payload, are
+	// written as KEY=value lines to a single file. With "pem" a PEM bundle is
+	// split into tls.crt, tls.key and ca.crt files in the directory given by
+	// FileName or Path.
+	Format string `json:"format" yaml:"format"`
+
+	// KeyFormat converts the private key of a "pem" entry to pkcs1 or pkcs8.
+	KeyFormat string `json:"keyFormat" yaml:"keyFormat"`
+
+	// Aliases makes the entry a file built from the payloads of the entries
+	// with these aliases, either an env file with Format "dotenv" or a
+	// keystore of their PEM certificates and private key with Format "pkcs12"
+	// or "jks". Requires no ResourceName.
+	Aliases []string `json:"aliases" yaml:"aliases"`
+
+	// PasswordAlias is the alias of the entry holding the password of a
+	// keystore.
+	PasswordAlias string `json:"passwordAlias" yaml:"passwordAlias"`
+
+	// Certificate configures the certificates issued for entries whose
+	// ResourceName is a Certificate Authority Service CA pool in the format
+	// projects/*/locations/*/caPools/*, and is required for them. It must set
+	// a CommonName, DNSNames or a Template.
+	Certificate *CertificateRequest `json:"certificate,omitempty" yaml:"certificate,omitempty"`
+
+	// VersionAlias replaces the "latest" version of a secret version
+	// ResourceName with a Secret Manager version alias, e.g. "prod".
+	VersionAlias string `json:"versionAlias" yaml:"versionAlias"`
+
+	// LatestEnabled mounts the newest ENABLED version of a secret instead of
+	// failing when its latest version is disabled. Requires a ResourceName
+	// ending in /versions/latest.
+	LatestEnabled bool `json:"latestEnabled" yaml:"latestEnabled"`
+
+	// MinVersion fails the mount if the version a secret resolves to is
+	// older than it, e.g. when an alias is moved back to a revoked version.
+	MinVersion int64 `json:"minVersion" yaml:"minVersion"`
+
+	// Render set to false mounts the raw payload of a parameter version, with
+	// its __REF__ secret references unresolved, instead of the rendered one.
+	// Defaults to true.
+	Render *bool `json:"render,omitempty" yaml:"render,omitempty"`
+
+	// Selector makes the entry a placeholder for the secrets of a project
+	// matching it, which are listed at mount time. Every match is written to
+	// a file named after its secret ID in the directory given by FileName or
+	// Path. The other options of the entry apply to every match. Requires no
+	// ResourceName.
+	Selector *SecretSelector `json:"selector,omitempty" yaml:"selector,omitempty"`
+}
+
+// SecretSelector selects the secrets of a project by label and name prefix,
+// at least one of which must be set.
+type SecretSelector struct {
+	Project string `json:"project" yaml:"project"`
+
+	// Location selects regional secrets instead of global ones.
+	Location string `json:"location" yaml:"location"`
+
+	// LabelSelector matches the secrets with all of these labels. An empty
+	// value matches any value of the label.
+	LabelSelector map[string]string `json:"labelSelector" yaml:"labelSelector"`
+
+	// NamePrefix matches the secrets whose ID starts with it.
+	NamePrefix string `json:"namePrefix" yaml:"namePrefix"`
+
+	// Version is the version, or version alias, of the matching secrets
+	// which is mounted. Defaults to "latest".
+	Version string `json:"version" yaml:"version"`
+}
+
+// CertificateRequest configures the certificate signing request submitted to
+// Certificate Authority Service. The private key is generated on the node and
+// written, together with the issued certificate and its chain, to the tls.key,
+// tls.crt and ca.crt files in the directory given by FileName or Path.
+type CertificateRequest struct {
+	// Template is a CertificateTemplate in the format
+	// projects/*/locations/*/certificateTemplates/*, required if neither
+	// CommonName nor DNSNames is set.
+	Template string `json:"template" yaml:"template"`
+
+	CommonName string   `json:"commonName" yaml:"commonName"`
+	DNSNames   []string `json:"dnsNames" yaml:"dnsNames"`
+
+	// Lifetime is the requested validity of the certificate, e.g. "24h".
+	// Defaults to the maximum lifetime allowed by the CA pool.
+	Lifetime string `json:"lifetime" yaml:"lifetime"`
+
+	// KeyAlgorithm is one of ecdsa-p256 (the default), ecdsa-p384, rsa-2048,
+	// rsa-3072 or rsa-4096.
+	KeyAlgorithm string `json:"keyAlgorithm" yaml:"keyAlgorithm"`
+}
+
+// SecretKey selects a value of a structured secret to be written to its own
+// file.
+type SecretKey struct {
+	// Key is a top-level key, or a path in the syntax of ExtractJSONPath.
+	Key string `json:"key" yaml:"key"`
+
+	// FileName is the name of the file within the directory of the secret.
+	// Defaults to Key.
+	FileName string `json:"fileName" yaml:"fileName"`
+
+	// Mode is the optional file mode for the file, overriding the mode of the
+	// secret.
+	Mode *int32 `json:"mode,omitempty" yaml:"mode,omitempty"`
 }
 
 // PodInfo includes details about the pod that is receiving the mount event.
@@ -97,6 +249,12 @@ type MountParams struct {
 	Permissions os.FileMode
 }
 
+// IsComposite returns true if the entry is built from the payloads of the
+// aliased entries of the mount instead of being fetched.
+func (s *Secret) IsComposite() bool {
+	return s.Template != "" || len(s.Aliases) > 0
+}
+
 // PathString returns either the FileName or Path parameter of the Secret.
 func (s *Secret) PathString() string {
 	if s.Path != "" {
@@ -196,6 +354,313 @@ func Parse(in *MountParams) (*MountConfig, error) {
 	if err := yaml.Unmarshal([]byte(attrib["secrets"]), &out.Secrets); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal secrets attribute: %v", err)
 	}
+	if err := expandResourceNames(out.Secrets, attrib["project"], attrib["location"]); err != nil {
+		return nil, err
+	}
+	if err := validateDecode(out.Secrets); err != nil {
+		return nil, err
+	}
+	if err := validateFormat(out.Secrets); err != nil {
+		return nil, err
+	}
+	if err := validateComposites(out.Secrets); err != nil {
+		return nil, err
+	}
+	if err := validateCertificates(out.Secrets); err != nil {
+		return nil, err
+	}
+	if err := validateSelectors(out.Secrets); err != nil {
+		return nil, err
+	}
+	if err := resolveVersionSelectors(out.Secrets); err != nil {
+		return nil, err
+	}
+	if err := validateRender(out.Secrets); err != nil {
+		return nil, err
+	}
 
 	return out, nil
 }
+
+// shortResourceNameRegexp matches the short forms of resource names, i.e.
+// "db-password", "db-password@5", "db-password:latest" or
+// "parameters/app-config@v1".
+var shortResourceNameRegexp = regexp.MustCompile(`^(?:(secrets|parameters)/)?([a-zA-Z0-9_-]+)(?:[@:]([a-zA-Z0-9_.-]+))?$`)
+
+// expandResourceNames expands the short resource names of secrets with the
+// project and location attributes of the SecretProviderClass, which also
+// default the project and location of selectors. Fully qualified names are
+// left as is.
+func expandResourceNames(secrets []*Secret, project, location string) error {
+	for _, s := range secrets {
+		if s.Selector != nil {
+			if s.Selector.Project == "" {
+				s.Selector.Project = project
+			}
+			if s.Selector.Location == "" && location != "global" {
+				s.Selector.Location = location
+			}
+		}
+		if s.ResourceName == "" || strings.HasPrefix(s.ResourceName, "projects/") || strings.HasPrefix(s.ResourceName, "gs://") {
+			continue
+		}
+		name, err := expandResourceName(s.ResourceName, project, location)
+		if err != nil {
+			return err
+		}
+		s.ResourceName = name
+	}
+	return nil
+}
+
+// expandResourceName expands a short resource name to a secret version, or a
+// parameter version if it starts with "parameters/". Secret versions default
+// to "latest" and are regional if location is set to anything but "global".
+// Parameter versions must name their version and default to the global
+// location.
+func expandResourceName(name, project, location string) (string, error) {
+	m := shortResourceNameRegexp.FindStringSubmatch(name)
+	if m == nil {
+		return "", fmt.Errorf("invalid resourceName %q, must be fully qualified or one of <secret>, <secret>@<version>, <secret>:<version> or parameters/<parameter>@<version>", name)
+	}
+	if project == "" {
+		return "", fmt.Errorf("resourceName %q is not fully qualified, set the project attribute of the SecretProviderClass", name)
+	}
+	kind, id, version := m[1], m[2], m[3]
+	if kind == "parameters" {
+		if version == "" {
+			return "", fmt.Errorf("resourceName %q must name a parameter version, e.g. %s@<version>", name, name)
+		}
+		if location == "" {
+			location = "global"
+		}
+		return fmt.Sprintf("projects/%s/locations/%s/parameters/%s/versions/%s", project, location, id, version), nil
+	}
+	if version == "" {
+		version = "latest"
+	}
+	if location == "" || location == "global" {
+		return fmt.Sprintf("projects/%s/secrets/%s/versions/%s", project, id, version), nil
+	}
+	return fmt.Sprintf("projects/%s/locations/%s/secrets/%s/versions/%s", project, location, id, version), nil
+}
+
+// validateComposites checks the aliases and composite entries of secrets.
+func validateComposites(secrets []*Secret) error {
+	aliases := make(map[string]bool)
+	for _, s := range secrets {
+		if s.Alias == "" {
+			continue
+		}
+		if s.IsComposite() {
+			return fmt.Errorf("composite entry %q cannot set alias", s.PathString())
+		}
+		if aliases[s.Alias] {
+			return fmt.Errorf("duplicate alias %q", s.Alias)
+		}
+		aliases[s.Alias] = true
+	}
+	for _, s := range secrets {
+		if !s.IsComposite() {
+			continue
+		}
+		if s.ResourceName != "" {
+			return fmt.Errorf("composite entry %q cannot set resourceName", s.PathString())
+		}
+		if s.PathString() == "" {
+			return fmt.Errorf("composite entry must set fileName or path")
+		}
+		if s.Template != "" && len(s.Aliases) > 0 {
+			return fmt.Errorf("entry %q cannot set both template and aliases", s.PathString())
+		}
+		if s.Template != "" {
+			if _, err := template.New(s.PathString()).Parse(s.Template); err != nil {
+				return fmt.Errorf("invalid template for %q: %v", s.PathString(), err)
+			}
+			continue
+		}
+		switch s.Format {
+		case "dotenv":
+			if s.PasswordAlias != "" {
+				return fmt.Errorf("entry %q with format \"dotenv\" cannot set passwordAlias", s.PathString())
+			}
+		case "pkcs12", "jks":
+			if s.PasswordAlias == "" {
+				return fmt.Errorf("keystore entry %q must set passwordAlias", s.PathString())
+			}
+			if !aliases[s.PasswordAlias] {
+				return fmt.Errorf("entry %q references unknown alias %q", s.PathString(), s.PasswordAlias)
+			}
+		default:
+			return fmt.Errorf("entry %q with aliases must set format \"dotenv\", \"pkcs12\" or \"jks\"", s.PathString())
+		}
+		for _, alias := range s.Aliases {
+			if !aliases[alias] {
+				return fmt.Errorf("entry %q references unknown alias %q", s.PathString(), alias)
+			}
+		}
+	}
+	return nil
+}
+
+// validateDecode checks the decode option of secrets.
+func validateDecode(secrets []*Secret) error {
+	for _, s := range secrets {
+		switch s.Decode {
+		case "", "base64", "base64url", "hex", "gzip":
+		default:
+			return fmt.Errorf("invalid decode %q for %q, must be one of base64, base64url, hex or gzip", s.Decode, s.PathString())
+		}
+	}
+	return nil
+}
+
+// validateFormat checks the format and keyFormat options of the fetched
+// entries of secrets. The formats of composite entries are checked by
+// validateComposites.
+func validateFormat(secrets []*Secret) error {
+	for _, s := range secrets {
+		if s.IsComposite() {
+			continue
+		}
+		switch s.Format {
+		case "", "dotenv", "pem":
+		default:
+			return fmt.Errorf("invalid format %q for %q, must be one of dotenv or pem", s.Format, s.PathString())
+		}
+		switch s.KeyFormat {
+		case "":
+		case "pkcs1", "pkcs8":
+			if s.Format != "pem" && s.Certificate == nil {
+				return fmt.Errorf("entry %q with keyFormat must set format \"pem\" or certificate", s.PathString())
+			}
+		default:
+			return fmt.Errorf("invalid keyFormat %q for %q, must be one of pkcs1 or pkcs8", s.KeyFormat, s.PathString())
+		}
+	}
+	return nil
+}
+
+// caPoolRegexp matches the Certificate Authority Service CA pools which
+// certificates are issued from.
+var caPoolRegexp = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/caPools/[^/]+$`)
+
+// validateCertificates checks the certificate options of secrets.
+func validateCertificates(secrets []*Secret) error {
+	for _, s := range secrets {
+		if caPoolRegexp.MatchString(s.ResourceName) {
+			if c := s.Certificate; c == nil || (c.CommonName == "" && len(c.DNSNames) == 0 && c.Template == "") {
+				return fmt.Errorf("certificate entry %q must set certificate commonName, dnsNames or template", s.ResourceName)
+			}
+		}
+		if s.Certificate == nil {
+			continue
+		}
+		if s.IsComposite() {
+			return fmt.Errorf("composite entry %q cannot set certificate", s.PathString())
+		}
+		if s.PathString() == "" {
+			return fmt.Errorf("certificate entry %q must set fileName or path", s.ResourceName)
+		}
+		if s.Certificate.Lifetime != "" {
+			if d, err := time.ParseDuration(s.Certificate.Lifetime); err != nil || d <= 0 {
+				return fmt.Errorf("invalid certificate lifetime %q for %q, must be a positive duration such as \"24h\"", s.Certificate.Lifetime, s.PathString())
+			}
+		}
+	}
+	return nil
+}
+
+// selectorTokenRegexp matches the characters allowed in secret IDs and labels.
+var selectorTokenRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]*$`)
+
+// validateSelectors checks the selector entries of secrets.
+func validateSelectors(secrets []*Secret) error {
+	for _, s := range secrets {
+		if s.Selector == nil {
+			continue
+		}
+		if s.ResourceName != "" || s.IsComposite() {
+			return fmt.Errorf("selector entry %q cannot set resourceName, template or aliases", s.PathString())
+		}
+		if s.Alias != "" || s.Certificate != nil || s.Default != nil {
+			return fmt.Errorf("selector entry %q cannot set alias, certificate or default", s.PathString())
+		}
+		if s.Selector.Project == "" {
+			return fmt.Errorf("selector entry %q must set project", s.PathString())
+		}
+		if s.Selector.NamePrefix == "" && len(s.Selector.LabelSelector) == 0 {
+			return fmt.Errorf("selector entry %q must set namePrefix or labelSelector", s.PathString())
+		}
+		for _, v := range []string{s.Selector.Project, s.Selector.Location, s.Selector.Version} {
+			if strings.ContainsAny(v, "/ ") {
+				return fmt.Errorf("invalid selector of entry %q, %q cannot contain '/' or spaces", s.PathString(), v)
+			}
+		}
+		if !selectorTokenRegexp.MatchString(s.Selector.NamePrefix) {
+			return fmt.Errorf("invalid namePrefix %q of entry %q", s.Selector.NamePrefix, s.PathString())
+		}
+		for k, v := range s.Selector.LabelSelector {
+			if k == "" || !selectorTokenRegexp.MatchString(k) || !selectorTokenRegexp.MatchString(v) {
+				return fmt.Errorf("invalid labelSelector %s=%s of entry %q", k, v, s.PathString())
+			}
+		}
+	}
+	return nil
+}
+
+// resolveVersionSelectors checks the version selectors of secrets and applies
+// their VersionAlias to the ResourceName.
+func resolveVersionSelectors(secrets []*Secret) error {
+	for _, s := range secrets {
+		if s.MinVersion < 0 {
+			return fmt.Errorf("invalid minVersion %d for %q", s.MinVersion, s.PathString())
+		}
+		if s.VersionAlias == "" && !s.LatestEnabled && s.MinVersion == 0 {
+			continue
+		}
+		if s.Selector != nil {
+			// latestEnabled and minVersion apply to every match once the
+			// selector is expanded
+			if s.VersionAlias != "" {
+				return fmt.Errorf("selector entry %q cannot set versionAlias, set the version of the selector instead", s.PathString())
+			}
+			if s.LatestEnabled && s.Selector.Version != "" && s.Selector.Version != "latest" {
+				return fmt.Errorf("selector entry %q cannot set latestEnabled with version %q", s.PathString(), s.Selector.Version)
+			}
+			continue
+		}
+		if !strings.Contains(s.ResourceName, "/secrets/") {
+			return fmt.Errorf("versionAlias, latestEnabled and minVersion are only supported for secret versions, got %q", s.ResourceName)
+		}
+		if s.VersionAlias == "" && !s.LatestEnabled {
+			continue
+		}
+		if s.VersionAlias != "" && s.LatestEnabled {
+			return fmt.Errorf("%q cannot set both versionAlias and latestEnabled", s.ResourceName)
+		}
+		if !strings.HasSuffix(s.ResourceName, "/versions/latest") {
+			return fmt.Errorf("versionAlias and latestEnabled require a resourceName ending in /versions/latest, got %q", s.ResourceName)
+		}
+		if s.VersionAlias != "" {
+			if s.VersionAlias == "latest" || !selectorTokenRegexp.MatchString(s.VersionAlias) {
+				return fmt.Errorf("invalid versionAlias %q for %q", s.VersionAlias, s.ResourceName)
+			}
+			s.ResourceName = strings.TrimSuffix(s.ResourceName, "latest") + s.VersionAlias
+		}
+	}
+	return nil
+}
+
+// validateRender checks that only parameter versions disable rendering.
+func validateRender(secrets []*Secret) error {
+	for _, s := range secrets {
+		if s.Render == nil || *s.Render {
+			continue
+		}
+		if !strings.Contains(s.ResourceName, "/parameters/") {
+			return fmt.Errorf("render is only supported for parameter versions, got %q for %q", s.ResourceName, s.PathString())
+		}
+	}
+	return nil
+}
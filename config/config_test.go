@@ -15,6 +15,7 @@
 package config
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -313,6 +314,318 @@ func TestParse(t *testing.T) {
 				AuthPodADC:  true,
 			},
 		},
+		{
+			name: "optional secret with default",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"flags.yaml\"\n  optional: true\n  default: \"enabled: false\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+			want: &MountConfig{
+				Secrets: []*Secret{
+					{
+						ResourceName: "projects/project/secrets/test/versions/latest",
+						FileName:     "flags.yaml",
+						Optional:     true,
+						Default:      stringPtr("enabled: false"),
+					},
+				},
+				PodInfo: &PodInfo{
+					Namespace:      "default",
+					Name:           "mypod",
+					UID:            "123",
+					ServiceAccount: "mysa",
+				},
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+				AuthPodADC:  true,
+			},
+		},
+		{
+			name: "secrets with extractJSONPath",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n  extractJSONPath: database.hosts[0].password\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+			want: &MountConfig{
+				Secrets: []*Secret{
+					{
+						ResourceName:    "projects/project/secrets/test/versions/latest",
+						FileName:        "good1.txt",
+						ExtractJSONPath: "database.hosts[0].password",
+					},
+				},
+				PodInfo: &PodInfo{
+					Namespace:      "default",
+					Name:           "mypod",
+					UID:            "123",
+					ServiceAccount: "mysa",
+				},
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+				AuthPodADC:  true,
+			},
+		},
+		{
+			name: "template entry",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/user/versions/latest\"\n  fileName: \"user.txt\"\n  alias: user\n- fileName: \"app.properties\"\n  template: \"user={{ .user }}\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+			want: &MountConfig{
+				Secrets: []*Secret{
+					{
+						ResourceName: "projects/project/secrets/user/versions/latest",
+						FileName:     "user.txt",
+						Alias:        "user",
+					},
+					{
+						FileName: "app.properties",
+						Template: "user={{ .user }}",
+					},
+				},
+				PodInfo: &PodInfo{
+					Namespace:      "default",
+					Name:           "mypod",
+					UID:            "123",
+					ServiceAccount: "mysa",
+				},
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+				AuthPodADC:  true,
+			},
+		},
+		{
+			name: "certificate entry",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/locations/us-central1/caPools/pool\"\n  path: \"mtls\"\n  certificate:\n    commonName: client\n    dnsNames: [client.example.com]\n    lifetime: 24h\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+			want: &MountConfig{
+				Secrets: []*Secret{
+					{
+						ResourceName: "projects/project/locations/us-central1/caPools/pool",
+						Path:         "mtls",
+						Certificate: &CertificateRequest{
+							CommonName: "client",
+							DNSNames:   []string{"client.example.com"},
+							Lifetime:   "24h",
+						},
+					},
+				},
+				PodInfo: &PodInfo{
+					Namespace:      "default",
+					Name:           "mypod",
+					UID:            "123",
+					ServiceAccount: "mysa",
+				},
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+				AuthPodADC:  true,
+			},
+		},
+		{
+			name: "selector entry",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- path: \"payments\"\n  selector:\n    project: project\n    labelSelector:\n      team: payments\n    namePrefix: db-\n    version: \"2\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+			want: &MountConfig{
+				Secrets: []*Secret{
+					{
+						Path: "payments",
+						Selector: &SecretSelector{
+							Project:       "project",
+							LabelSelector: map[string]string{"team": "payments"},
+							NamePrefix:    "db-",
+							Version:       "2",
+						},
+					},
+				},
+				PodInfo: &PodInfo{
+					Namespace:      "default",
+					Name:           "mypod",
+					UID:            "123",
+					ServiceAccount: "mysa",
+				},
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+				AuthPodADC:  true,
+			},
+		},
+		{
+			name: "short resource names",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"db-password@5\"\n  fileName: \"password.txt\"\n- resourceName: \"parameters/app-config@v1\"\n  fileName: \"config.yaml\"\n- path: \"payments\"\n  selector:\n    namePrefix: db-\n",
+					"project": "project",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+			want: &MountConfig{
+				Secrets: []*Secret{
+					{
+						ResourceName: "projects/project/secrets/db-password/versions/5",
+						FileName:     "password.txt",
+					},
+					{
+						ResourceName: "projects/project/locations/global/parameters/app-config/versions/v1",
+						FileName:     "config.yaml",
+					},
+					{
+						Path: "payments",
+						Selector: &SecretSelector{
+							Project:    "project",
+							NamePrefix: "db-",
+						},
+					},
+				},
+				PodInfo: &PodInfo{
+					Namespace:      "default",
+					Name:           "mypod",
+					UID:            "123",
+					ServiceAccount: "mysa",
+				},
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+				AuthPodADC:  true,
+			},
+		},
+		{
+			name: "version selectors",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/a/versions/latest\"\n  fileName: \"a.txt\"\n  versionAlias: prod\n  minVersion: 4\n- resourceName: \"b\"\n  fileName: \"b.txt\"\n  latestEnabled: true\n",
+					"project": "project",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+			want: &MountConfig{
+				Secrets: []*Secret{
+					{
+						ResourceName: "projects/project/secrets/a/versions/prod",
+						FileName:     "a.txt",
+						VersionAlias: "prod",
+						MinVersion:   4,
+					},
+					{
+						ResourceName:  "projects/project/secrets/b/versions/latest",
+						FileName:      "b.txt",
+						LatestEnabled: true,
+					},
+				},
+				PodInfo: &PodInfo{
+					Namespace:      "default",
+					Name:           "mypod",
+					UID:            "123",
+					ServiceAccount: "mysa",
+				},
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+				AuthPodADC:  true,
+			},
+		},
+		{
+			name: "raw parameter version",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"parameters/app-config@v1\"\n  fileName: \"app.json\"\n  render: false\n",
+					"project": "project",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+			want: &MountConfig{
+				Secrets: []*Secret{
+					{
+						ResourceName: "projects/project/locations/global/parameters/app-config/versions/v1",
+						FileName:     "app.json",
+						Render:       boolPtr(false),
+					},
+				},
+				PodInfo: &PodInfo{
+					Namespace:      "default",
+					Name:           "mypod",
+					UID:            "123",
+					ServiceAccount: "mysa",
+				},
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+				AuthPodADC:  true,
+			},
+		},
 	}
 	t.Setenv("ALLOW_NODE_PUBLISH_SECRET", "true")
 	for _, tc := range tests {
@@ -334,84 +647,390 @@ func TestParseErrors(t *testing.T) {
 		in   *MountParams
 	}{
 		{
-			name: "unparsable attributes",
+			name: "unparsable attributes",
+			in: &MountParams{
+				Attributes:  "",
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "missing secrets attribute",
+			in: &MountParams{
+				Attributes:  "{}",
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "unparsable secrets mode",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n  mode: \"-rw-------\"",
+				}
+				`,
+				KubeSecrets: "",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "unparsable kubernetes secrets",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123"
+				}
+				`,
+				KubeSecrets: "",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "both nodePublishSecretRef and provider-adc",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n",
+					"auth": "provider-adc",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: `{"key.json":"{\"private_key_id\": \"123\",\"private_key\": \"a-secret\",\"token_uri\": \"https://example.com/token\",\"type\": \"service_account\"}"}`,
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "both nodePublishSecretRef and pod-adc",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n",
+					"auth": "pod-adc",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: `{"key.json":"{\"private_key_id\": \"123\",\"private_key\": \"a-secret\",\"token_uri\": \"https://example.com/token\",\"type\": \"service_account\"}"}`,
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "duplicate alias",
 			in: &MountParams{
-				Attributes:  "",
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/a/versions/latest\"\n  fileName: \"a.txt\"\n  alias: db\n- resourceName: \"projects/project/secrets/b/versions/latest\"\n  fileName: \"b.txt\"\n  alias: db\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
 				KubeSecrets: "{}",
 				TargetPath:  "/tmp/foo",
 				Permissions: 777,
 			},
 		},
 		{
-			name: "missing secrets attribute",
+			name: "template with resourceName",
 			in: &MountParams{
-				Attributes:  "{}",
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/a/versions/latest\"\n  fileName: \"a.txt\"\n  template: \"{{ .a }}\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
 				KubeSecrets: "{}",
 				TargetPath:  "/tmp/foo",
 				Permissions: 777,
 			},
 		},
 		{
-			name: "unparsable secrets mode",
+			name: "unparsable template",
 			in: &MountParams{
 				Attributes: `
 				{
-					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n  mode: \"-rw-------\"",
+					"secrets": "- fileName: \"a.txt\"\n  template: \"{{ .a \"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
 				}
 				`,
-				KubeSecrets: "",
+				KubeSecrets: "{}",
 				TargetPath:  "/tmp/foo",
 				Permissions: 777,
 			},
 		},
 		{
-			name: "unparsable kubernetes secrets",
+			name: "invalid certificate lifetime",
 			in: &MountParams{
 				Attributes: `
 				{
-					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n",
+					"secrets": "- resourceName: \"projects/project/locations/us-central1/caPools/pool\"\n  path: \"mtls\"\n  certificate:\n    commonName: client\n    lifetime: 1d\n",
 					"csi.storage.k8s.io/pod.namespace": "default",
 					"csi.storage.k8s.io/pod.name": "mypod",
-					"csi.storage.k8s.io/pod.uid": "123"
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
 				}
 				`,
-				KubeSecrets: "",
+				KubeSecrets: "{}",
 				TargetPath:  "/tmp/foo",
 				Permissions: 777,
 			},
 		},
 		{
-			name: "both nodePublishSecretRef and provider-adc",
+			name: "selector with resourceName",
 			in: &MountParams{
 				Attributes: `
 				{
-					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n",
-					"auth": "provider-adc",
+					"secrets": "- resourceName: \"projects/project/secrets/a/versions/latest\"\n  path: \"a\"\n  selector:\n    project: project\n",
 					"csi.storage.k8s.io/pod.namespace": "default",
 					"csi.storage.k8s.io/pod.name": "mypod",
 					"csi.storage.k8s.io/pod.uid": "123",
 					"csi.storage.k8s.io/serviceAccount.name": "mysa"
 				}
 				`,
-				KubeSecrets: `{"key.json":"{\"private_key_id\": \"123\",\"private_key\": \"a-secret\",\"token_uri\": \"https://example.com/token\",\"type\": \"service_account\"}"}`,
+				KubeSecrets: "{}",
 				TargetPath:  "/tmp/foo",
 				Permissions: 777,
 			},
 		},
 		{
-			name: "both nodePublishSecretRef and pod-adc",
+			name: "selector without criteria",
 			in: &MountParams{
 				Attributes: `
 				{
-					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n",
-					"auth": "pod-adc",
+					"secrets": "- path: \"a\"\n  selector:\n    project: project\n",
 					"csi.storage.k8s.io/pod.namespace": "default",
 					"csi.storage.k8s.io/pod.name": "mypod",
 					"csi.storage.k8s.io/pod.uid": "123",
 					"csi.storage.k8s.io/serviceAccount.name": "mysa"
 				}
 				`,
-				KubeSecrets: `{"key.json":"{\"private_key_id\": \"123\",\"private_key\": \"a-secret\",\"token_uri\": \"https://example.com/token\",\"type\": \"service_account\"}"}`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "selector with invalid label",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- path: \"a\"\n  selector:\n    project: project\n    labelSelector:\n      team: \"a OR b\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "short resource name without project",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"db-password\"\n  fileName: \"password.txt\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "latestEnabled with pinned version",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/a/versions/3\"\n  fileName: \"a.txt\"\n  latestEnabled: true\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "minVersion for parameter version",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/locations/global/parameters/p/versions/v1\"\n  fileName: \"p.txt\"\n  minVersion: 2\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "render false for secret version",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/a/versions/1\"\n  fileName: \"a.txt\"\n  render: false\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "unknown decode",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/a/versions/1\"\n  fileName: \"a.txt\"\n  decode: base46\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "unknown format",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/a/versions/1\"\n  fileName: \"a.txt\"\n  format: pem2\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "unknown keyFormat",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/a/versions/1\"\n  fileName: \"a.txt\"\n  format: pem\n  keyFormat: pkcs7\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "keyFormat without pem format",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/a/versions/1\"\n  fileName: \"a.txt\"\n  keyFormat: pkcs8\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "CA pool entry without certificate",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/locations/us-central1/caPools/pool\"\n  path: \"mtls\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "certificate without subject or template",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/locations/us-central1/caPools/pool\"\n  path: \"mtls\"\n  certificate:\n    lifetime: 24h\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "dotenv entry with unknown alias",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- fileName: \"app.env\"\n  format: dotenv\n  aliases: [db]\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
 				TargetPath:  "/tmp/foo",
 				Permissions: 777,
 			},
@@ -537,3 +1156,46 @@ func TestParseWithRestrictedNodePublishRef(t *testing.T) {
 func int32Ptr(i int32) *int32 {
 	return &i
 }
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestExpandResourceName(t *testing.T) {
+	tests := []struct {
+		name          string
+		location      string
+		want          string
+		wantErrSubstr string
+	}{
+		{name: "db-password", want: "projects/project/secrets/db-password/versions/latest"},
+		{name: "db-password@5", want: "projects/project/secrets/db-password/versions/5"},
+		{name: "db-password:latest", want: "projects/project/secrets/db-password/versions/latest"},
+		{name: "secrets/db-password:prod", want: "projects/project/secrets/db-password/versions/prod"},
+		{name: "db-password", location: "global", want: "projects/project/secrets/db-password/versions/latest"},
+		{name: "db-password@5", location: "us-central1", want: "projects/project/locations/us-central1/secrets/db-password/versions/5"},
+		{name: "parameters/app-config@v1", want: "projects/project/locations/global/parameters/app-config/versions/v1"},
+		{name: "parameters/app-config:v1", location: "us-central1", want: "projects/project/locations/us-central1/parameters/app-config/versions/v1"},
+		{name: "parameters/app-config", wantErrSubstr: "must name a parameter version"},
+		{name: "db password", wantErrSubstr: "invalid resourceName \"db password\""},
+		{name: "keys/db-password", wantErrSubstr: "invalid resourceName"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name+"/"+tc.location, func(t *testing.T) {
+			got, err := expandResourceName(tc.name, "project", tc.location)
+			if tc.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrSubstr) {
+					t.Errorf("expandResourceName() got err = %v, want err containing %q", err, tc.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("expandResourceName() = %q, %v, want %q, nil", got, err, tc.want)
+			}
+		})
+	}
+}
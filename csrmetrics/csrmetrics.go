@@ -32,6 +32,25 @@ const (
 	OutboundRPCStatusOK       OutboundRPCStatus = "ok"
 )
 
+// CacheResult is the outcome of a lookup in one of the provider caches.
+type CacheResult string
+
+// Result constants for cache metrics
+const (
+	CacheHit  CacheResult = "hit"
+	CacheMiss CacheResult = "miss"
+)
+
+// ChecksumResult is the outcome of verifying the checksum of a fetched payload.
+type ChecksumResult string
+
+// Result constants for checksum metrics
+const (
+	ChecksumMatch    ChecksumResult = "match"
+	ChecksumMismatch ChecksumResult = "mismatch"
+	ChecksumMissing  ChecksumResult = "missing"
+)
+
 var (
 	// Observation function to observe delay
 	// Update this method for unit tests
@@ -47,12 +66,36 @@ var (
 		Name: "outbound_rpc_latency",
 		Help: "Latency of outbound RPCs to GCP (in seconds)",
 	}, []string{"status", "kind"})
+
+	cacheLookupCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_lookup_count",
+		Help: "Count of lookups in the provider in-memory caches",
+	}, []string{"cache", "result"})
+
+	outboundRPCQueueWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "outbound_rpc_queue_wait",
+		Help: "Time outbound RPCs to GCP waited for the concurrency and rate limits (in seconds)",
+	}, []string{"kind"})
+
+	stalePayloadCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "stale_payload_count",
+		Help: "Count of payloads served from the cache after fetching them from GCP failed",
+	}, []string{"kind"})
+
+	payloadChecksumCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payload_checksum_count",
+		Help: "Count of CRC32C verifications of payloads fetched from Secret Manager",
+	}, []string{"result"})
 )
 
 func init() {
 	prometheus.MustRegister(
 		outboundRPCCount,
 		outboundRPCLatency,
+		cacheLookupCount,
+		outboundRPCQueueWait,
+		stalePayloadCount,
+		payloadChecksumCount,
 	)
 }
 
@@ -67,3 +110,24 @@ func OutboundRPCStartRecorder(kind string) func(status OutboundRPCStatus) {
 		outboundRPCLatency.WithLabelValues(string(status), kind).Observe(timeSinceSeconds(start))
 	}
 }
+
+// RecordOutboundRPCQueueWait records how long an outbound RPC to the API kind
+// waited before it could be sent.
+func RecordOutboundRPCQueueWait(kind string, wait time.Duration) {
+	outboundRPCQueueWait.WithLabelValues(kind).Observe(wait.Seconds())
+}
+
+// RecordCacheLookup records the result of a lookup in the named cache.
+func RecordCacheLookup(cache string, result CacheResult) {
+	cacheLookupCount.WithLabelValues(cache, string(result)).Inc()
+}
+
+// RecordStalePayload records that a stale payload of the API kind was served.
+func RecordStalePayload(kind string) {
+	stalePayloadCount.WithLabelValues(kind).Inc()
+}
+
+// RecordPayloadChecksum records the result of a payload checksum verification.
+func RecordPayloadChecksum(result ChecksumResult) {
+	payloadChecksumCount.WithLabelValues(string(result)).Inc()
+}
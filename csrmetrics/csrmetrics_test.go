@@ -206,3 +206,68 @@ func TestOutboundRPCStartRecorder(t *testing.T) {
 	}
 
 }
+
+func TestRecordCacheLookup(t *testing.T) {
+	RecordCacheLookup("test_cache_1", CacheHit)
+	RecordCacheLookup("test_cache_1", CacheHit)
+	RecordCacheLookup("test_cache_1", CacheMiss)
+	RecordCacheLookup("test_cache_2", CacheMiss)
+
+	expectedCountMetric := `
+	# HELP cache_lookup_count Count of lookups in the provider in-memory caches
+	# TYPE cache_lookup_count counter
+	cache_lookup_count{cache="test_cache_1",result="hit"} 2
+	cache_lookup_count{cache="test_cache_1",result="miss"} 1
+	cache_lookup_count{cache="test_cache_2",result="miss"} 1
+	`
+
+	if err := testutil.CollectAndCompare(cacheLookupCount, strings.NewReader(expectedCountMetric)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestRecordPayloadChecksum(t *testing.T) {
+	RecordPayloadChecksum(ChecksumMatch)
+	RecordPayloadChecksum(ChecksumMatch)
+	RecordPayloadChecksum(ChecksumMismatch)
+	RecordPayloadChecksum(ChecksumMissing)
+
+	expectedCountMetric := `
+	# HELP payload_checksum_count Count of CRC32C verifications of payloads fetched from Secret Manager
+	# TYPE payload_checksum_count counter
+	payload_checksum_count{result="match"} 2
+	payload_checksum_count{result="mismatch"} 1
+	payload_checksum_count{result="missing"} 1
+	`
+
+	if err := testutil.CollectAndCompare(payloadChecksumCount, strings.NewReader(expectedCountMetric)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestRecordOutboundRPCQueueWait(t *testing.T) {
+	RecordOutboundRPCQueueWait("test_api_1", 0)
+	RecordOutboundRPCQueueWait("test_api_1", 2*time.Second)
+	RecordOutboundRPCQueueWait("test_api_2", time.Second)
+
+	if got := testutil.CollectAndCount(outboundRPCQueueWait); got != 2 {
+		t.Errorf("CollectAndCount(outboundRPCQueueWait) = %d, want 2", got)
+	}
+}
+
+func TestRecordStalePayload(t *testing.T) {
+	RecordStalePayload("test_api_1")
+	RecordStalePayload("test_api_1")
+	RecordStalePayload("test_api_2")
+
+	expectedCountMetric := `
+	# HELP stale_payload_count Count of payloads served from the cache after fetching them from GCP failed
+	# TYPE stale_payload_count counter
+	stale_payload_count{kind="test_api_1"} 2
+	stale_payload_count{kind="test_api_2"} 1
+	`
+
+	if err := testutil.CollectAndCompare(stalePayloadCount, strings.NewReader(expectedCountMetric)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
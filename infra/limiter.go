@@ -0,0 +1,103 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"golang.org/x/time/rate"
+)
+
+// API identifies a Google Cloud API the provider calls.
+type API string
+
+// APIs whose outbound calls are limited.
+const (
+	APISecretManager    API = "secretmanager"
+	APIParameterManager API = "parametermanager"
+	APIIAMCredentials   API = "iamcredentials"
+	APISTS              API = "sts"
+	APICloudKMS         API = "cloudkms"
+	APICloudStorage     API = "storage"
+	APIPrivateCA        API = "privateca"
+)
+
+// RateLimit configures the token bucket of an API. A non-positive QPS
+// disables rate limiting.
+type RateLimit struct {
+	QPS   float64
+	Burst int
+}
+
+// Limiter bounds the number of concurrent outbound API calls and the rate of
+// calls per API. It is shared across mounts, so that a node with many pods
+// stays within the per-project quota.
+type Limiter struct {
+	// concurrency is nil if the number of concurrent calls is unbounded.
+	concurrency chan struct{}
+	rates       map[API]*rate.Limiter
+}
+
+// NewLimiter returns a Limiter allowing maxConcurrent calls in flight, or an
+// unbounded number if maxConcurrent is not positive, and limiting the rate of
+// calls of each API in rates.
+func NewLimiter(maxConcurrent int, rates map[API]RateLimit) *Limiter {
+	l := &Limiter{rates: make(map[API]*rate.Limiter)}
+	if maxConcurrent > 0 {
+		l.concurrency = make(chan struct{}, maxConcurrent)
+	}
+	for api, r := range rates {
+		if r.QPS <= 0 {
+			continue
+		}
+		burst := r.Burst
+		if burst <= 0 {
+			burst = int(math.Ceil(r.QPS))
+		}
+		l.rates[api] = rate.NewLimiter(rate.Limit(r.QPS), burst)
+	}
+	return l
+}
+
+// Acquire blocks until a call to api may be made and returns a function which
+// must be called once the call completed. The time spent waiting is recorded
+// as a metric. A nil Limiter does not limit calls.
+func (l *Limiter) Acquire(ctx context.Context, api API) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	start := time.Now()
+	defer func() {
+		csrmetrics.RecordOutboundRPCQueueWait(string(api), time.Since(start))
+	}()
+
+	if r, ok := l.rates[api]; ok {
+		if err := r.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if l.concurrency == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.concurrency <- struct{}{}:
+		return func() { <-l.concurrency }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
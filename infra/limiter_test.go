@@ -0,0 +1,92 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterConcurrency(t *testing.T) {
+	l := NewLimiter(2, nil)
+
+	var inFlight, maxInFlight atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.Acquire(context.Background(), APISecretManager)
+			if err != nil {
+				t.Errorf("Acquire() got err = %v, want err = nil", err)
+				return
+			}
+			defer release()
+			n := inFlight.Add(1)
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			inFlight.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if got := maxInFlight.Load(); got > 2 {
+		t.Errorf("Acquire() allowed %d calls in flight, want at most 2", got)
+	}
+}
+
+func TestLimiterContextCancelled(t *testing.T) {
+	l := NewLimiter(1, map[API]RateLimit{APISTS: {QPS: 0.001, Burst: 1}})
+
+	release, err := l.Acquire(context.Background(), APISecretManager)
+	if err != nil {
+		t.Fatalf("Acquire() got err = %v, want err = nil", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, APISecretManager); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() with full concurrency got err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	release()
+
+	// the first call uses the burst, the second has to wait far beyond the
+	// deadline.
+	releaseSTS, err := l.Acquire(context.Background(), APISTS)
+	if err != nil {
+		t.Fatalf("Acquire(APISTS) got err = %v, want err = nil", err)
+	}
+	releaseSTS()
+	if _, err := l.Acquire(ctx, APISTS); err == nil {
+		t.Errorf("Acquire(APISTS) over the rate limit got err = nil, want error")
+	}
+}
+
+func TestLimiterNil(t *testing.T) {
+	var l *Limiter
+	release, err := l.Acquire(context.Background(), APIIAMCredentials)
+	if err != nil {
+		t.Fatalf("Acquire() on nil Limiter got err = %v, want err = nil", err)
+	}
+	release()
+}
@@ -0,0 +1,117 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// WithoutSDKRetries disables the retries of the Google Cloud client libraries
+// for calls which are retried by a RetryPolicy instead.
+var WithoutSDKRetries = gax.WithRetry(func() gax.Retryer { return nil })
+
+// RetryPolicy retries calls failing with a transient error using exponential
+// backoff with jitter.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of calls, including the first one.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// RetryableCodes are the status codes of the errors which are retried.
+	RetryableCodes []codes.Code
+}
+
+// Do calls call until it succeeds, fails with an error that is not retryable
+// or the policy gives up. No retry is attempted if its backoff would end
+// after the deadline of ctx. The error of the last call is returned. A nil
+// RetryPolicy calls call once.
+func (p *RetryPolicy) Do(ctx context.Context, operation string, call func() error) error {
+	if p == nil {
+		return call()
+	}
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= p.MaxAttempts || !slices.Contains(p.RetryableCodes, status.Code(err)) {
+			return err
+		}
+		// Equal jitter: wait between half and the full backoff.
+		wait := backoff/2 + rand.N(backoff/2+1)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			klog.InfoS("not retrying, request deadline would be exceeded", "operation", operation, "attempt", attempt, "err", err.Error())
+			return err
+		}
+		klog.InfoS("retrying after transient error", "operation", operation, "attempt", attempt, "max_attempts", p.MaxAttempts, "backoff", wait.String(), "err", err.Error())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff = min(time.Duration(float64(backoff)*p.Multiplier), p.MaxBackoff)
+	}
+}
+
+// ParseCodes parses a comma separated list of status code names such as
+// "UNAVAILABLE,RESOURCE_EXHAUSTED".
+func ParseCodes(s string) ([]codes.Code, error) {
+	var out []codes.Code
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var c codes.Code
+		if err := c.UnmarshalJSON([]byte(fmt.Sprintf("%q", strings.ToUpper(name)))); err != nil {
+			return nil, fmt.Errorf("invalid status code %q: %w", name, err)
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// HTTPStatusCode maps the HTTP status of a failed request to a status code, so
+// that calls of HTTP APIs are retried and reported like gRPC calls.
+func HTTPStatusCode(httpStatus int) codes.Code {
+	switch {
+	case httpStatus == http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case httpStatus >= http.StatusInternalServerError:
+		return codes.Unavailable
+	case httpStatus == http.StatusBadRequest:
+		return codes.InvalidArgument
+	case httpStatus == http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case httpStatus == http.StatusForbidden:
+		return codes.PermissionDenied
+	case httpStatus == http.StatusNotFound:
+		return codes.NotFound
+	default:
+		return codes.Unknown
+	}
+}
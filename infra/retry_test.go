@@ -0,0 +1,152 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Multiplier:     2,
+		RetryableCodes: []codes.Code{codes.Unavailable, codes.ResourceExhausted},
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       *RetryPolicy
+		errs         []error
+		wantAttempts int
+		wantCode     codes.Code
+	}{
+		{
+			name:         "success",
+			policy:       testRetryPolicy(),
+			errs:         []error{nil},
+			wantAttempts: 1,
+			wantCode:     codes.OK,
+		},
+		{
+			name:         "transient error then success",
+			policy:       testRetryPolicy(),
+			errs:         []error{status.Error(codes.Unavailable, "unavailable"), status.Error(codes.ResourceExhausted, "quota"), nil},
+			wantAttempts: 3,
+			wantCode:     codes.OK,
+		},
+		{
+			name:         "gives up after max attempts",
+			policy:       testRetryPolicy(),
+			errs:         []error{status.Error(codes.Unavailable, "1"), status.Error(codes.Unavailable, "2"), status.Error(codes.Unavailable, "3"), nil},
+			wantAttempts: 3,
+			wantCode:     codes.Unavailable,
+		},
+		{
+			name:         "permanent error",
+			policy:       testRetryPolicy(),
+			errs:         []error{status.Error(codes.PermissionDenied, "denied"), nil},
+			wantAttempts: 1,
+			wantCode:     codes.PermissionDenied,
+		},
+		{
+			name:         "nil policy",
+			policy:       nil,
+			errs:         []error{status.Error(codes.Unavailable, "unavailable"), nil},
+			wantAttempts: 1,
+			wantCode:     codes.Unavailable,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			err := tc.policy.Do(context.Background(), "test", func() error {
+				attempts++
+				return tc.errs[attempts-1]
+			})
+			if attempts != tc.wantAttempts {
+				t.Errorf("Do() made %d attempts, want %d", attempts, tc.wantAttempts)
+			}
+			if got := status.Code(err); got != tc.wantCode {
+				t.Errorf("Do() got code = %v, want %v", got, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoDeadline(t *testing.T) {
+	p := testRetryPolicy()
+	p.InitialBackoff = time.Hour
+	p.MaxBackoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	attempts := 0
+	start := time.Now()
+	err := p.Do(ctx, "test", func() error {
+		attempts++
+		return status.Error(codes.Unavailable, "unavailable")
+	})
+	if attempts != 1 || status.Code(err) != codes.Unavailable {
+		t.Errorf("Do() = %v after %d attempts, want unavailable after 1 attempt", err, attempts)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Do() waited for a backoff beyond the deadline")
+	}
+}
+
+func TestParseCodes(t *testing.T) {
+	got, err := ParseCodes("UNAVAILABLE, resource_exhausted,,DEADLINE_EXCEEDED")
+	if err != nil {
+		t.Fatalf("ParseCodes() got err = %v, want err = nil", err)
+	}
+	want := []codes.Code{codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseCodes() returned diff (-want +got):\n%s", diff)
+	}
+	if _, err := ParseCodes("NOT_A_CODE"); err == nil {
+		t.Errorf("ParseCodes(NOT_A_CODE) got err = nil, want error")
+	}
+}
+
+func TestHTTPStatusCode(t *testing.T) {
+	tests := []struct {
+		httpStatus int
+		want       codes.Code
+	}{
+		{httpStatus: http.StatusTooManyRequests, want: codes.ResourceExhausted},
+		{httpStatus: http.StatusServiceUnavailable, want: codes.Unavailable},
+		{httpStatus: http.StatusBadRequest, want: codes.InvalidArgument},
+		{httpStatus: http.StatusUnauthorized, want: codes.Unauthenticated},
+		{httpStatus: http.StatusForbidden, want: codes.PermissionDenied},
+		{httpStatus: http.StatusNotFound, want: codes.NotFound},
+		{httpStatus: http.StatusConflict, want: codes.Unknown},
+	}
+	for _, tc := range tests {
+		if got := HTTPStatusCode(tc.httpStatus); got != tc.want {
+			t.Errorf("HTTPStatusCode(%d) = %v, want %v", tc.httpStatus, got, tc.want)
+		}
+	}
+}
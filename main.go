@@ -32,21 +32,29 @@ import (
 
 	"cloud.google.com/go/compute/metadata"
 	iam "cloud.google.com/go/iam/credentials/apiv1"
+	kms "cloud.google.com/go/kms/apiv1"
 	parametermanager "cloud.google.com/go/parametermanager/apiv1"
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	privateca "cloud.google.com/go/security/privateca/apiv1"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/auth"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/infra"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/server"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/util"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/vars"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	logsapi "k8s.io/component-base/logs/api/v1"
 	jlogs "k8s.io/component-base/logs/json"
 	"k8s.io/klog/v2"
@@ -54,14 +62,42 @@ import (
 )
 
 var (
-	kubeconfig            = flag.String("kubeconfig", "", "absolute path to kubeconfig file")
-	logFormatJSON         = flag.Bool("log-format-json", true, "set log formatter to json")
-	metricsAddr           = flag.String("metrics_addr", ":8095", "configure http listener for reporting metrics")
-	enableProfile         = flag.Bool("enable-pprof", false, "enable pprof profiling")
-	debugAddr             = flag.String("debug_addr", "localhost:6060", "port for pprof profiling")
-	_                     = flag.Bool("write_secrets", false, "[unused]")
-	smConnectionPoolSize  = flag.Int("sm_connection_pool_size", 5, "size of the connection pool for the secret manager API client")
-	iamConnectionPoolSize = flag.Int("iam_connection_pool_size", 5, "size of the connection pool for the IAM API client")
+	kubeconfig                = flag.String("kubeconfig", "", "absolute path to kubeconfig file")
+	logFormatJSON             = flag.Bool("log-format-json", true, "set log formatter to json")
+	metricsAddr               = flag.String("metrics_addr", ":8095", "configure http listener for reporting metrics")
+	enableProfile             = flag.Bool("enable-pprof", false, "enable pprof profiling")
+	debugAddr                 = flag.String("debug_addr", "localhost:6060", "port for pprof profiling")
+	_                         = flag.Bool("write_secrets", false, "[unused]")
+	smConnectionPoolSize      = flag.Int("sm_connection_pool_size", 5, "size of the connection pool for the secret manager API client")
+	iamConnectionPoolSize     = flag.Int("iam_connection_pool_size", 5, "size of the connection pool for the IAM API client")
+	enableTokenCache          = flag.Bool("enable_token_cache", true, "cache workload identity tokens across mounts until shortly before they expire")
+	regionalClientIdleTimeout = flag.Duration("regional_client_idle_timeout", 0, "close regional API clients which have not been used for this long, 0 keeps them open")
+	payloadCacheSize          = flag.Int("payload_cache_size", 0, "maximum number of fetched payloads kept in memory, 0 disables the payload cache")
+	payloadCacheTTL           = flag.Duration("payload_cache_ttl", 30*time.Second, "how long payloads fetched through an alias such as 'latest' are cached")
+	payloadCachePinnedTTL     = flag.Duration("payload_cache_pinned_ttl", 0, "how long payloads of pinned secret versions are cached, 0 keeps them until evicted")
+	maxConcurrentRequests     = flag.Int("max_concurrent_requests", 0, "maximum number of outbound API calls in flight across all mounts, 0 is unbounded")
+	smQPS                     = flag.Float64("sm_qps", 0, "maximum rate of secretmanager API calls per second, 0 is unlimited")
+	smBurst                   = flag.Int("sm_burst", 0, "burst of secretmanager API calls above sm_qps, defaults to sm_qps")
+	pmQPS                     = flag.Float64("pm_qps", 0, "maximum rate of parametermanager API calls per second, 0 is unlimited")
+	pmBurst                   = flag.Int("pm_burst", 0, "burst of parametermanager API calls above pm_qps, defaults to pm_qps")
+	iamQPS                    = flag.Float64("iam_qps", 0, "maximum rate of iamcredentials API calls per second, 0 is unlimited")
+	iamBurst                  = flag.Int("iam_burst", 0, "burst of iamcredentials API calls above iam_qps, defaults to iam_qps")
+	stsQPS                    = flag.Float64("sts_qps", 0, "maximum rate of identity binding token exchanges per second, 0 is unlimited")
+	stsBurst                  = flag.Int("sts_burst", 0, "burst of identity binding token exchanges above sts_qps, defaults to sts_qps")
+	kmsQPS                    = flag.Float64("kms_qps", 0, "maximum rate of cloudkms API calls per second, 0 is unlimited")
+	kmsBurst                  = flag.Int("kms_burst", 0, "burst of cloudkms API calls above kms_qps, defaults to kms_qps")
+	privateCAQPS              = flag.Float64("privateca_qps", 0, "maximum rate of privateca certificate issuance per second, 0 is unlimited")
+	privateCABurst            = flag.Int("privateca_burst", 0, "burst of privateca certificate issuance above privateca_qps, defaults to privateca_qps")
+	storageQPS                = flag.Float64("storage_qps", 0, "maximum rate of Cloud Storage object downloads per second, 0 is unlimited")
+	storageBurst              = flag.Int("storage_burst", 0, "burst of Cloud Storage object downloads above storage_qps, defaults to storage_qps")
+	storageMaxObjectSize      = flag.Int64("storage_max_object_size", 1<<20, "maximum size in bytes of mounted Cloud Storage objects, 0 is unlimited")
+	maxSelectedSecrets        = flag.Int("max_selected_secrets", 100, "maximum number of secrets the selector entries of a mount may expand to in total, 0 is unlimited")
+	retryMaxAttempts          = flag.Int("retry_max_attempts", 5, "maximum number of attempts of outbound API calls failing with a transient error, 0 leaves retries to the client libraries")
+	retryInitialBackoff       = flag.Duration("retry_initial_backoff", 100*time.Millisecond, "backoff before the first retry of an outbound API call")
+	retryMaxBackoff           = flag.Duration("retry_max_backoff", 5*time.Second, "maximum backoff between retries of an outbound API call")
+	retryMultiplier           = flag.Float64("retry_multiplier", 2, "factor by which the backoff grows after each retry")
+	staleOnErrorMaxStaleness  = flag.Duration("stale_on_error_max_staleness", 0, "serve the last fetched payload of a resource up to this old when fetching it fails with a transient error, requires payload_cache_size, 0 disables")
+	retryCodes                = flag.String("retry_codes", "UNAVAILABLE,RESOURCE_EXHAUSTED", "comma separated status codes of outbound API calls which are retried")
 
 	version = "dev"
 )
@@ -115,47 +151,112 @@ func main() {
 	//
 	// build without auth so that authentication can be re-added on a per-RPC
 	// basis for each mount
-	clientOptions := []option.ClientOption{
-		option.WithUserAgent(ua),
-		// tell the secretmanager library to not add transport-level ADC since
-		// we need to override on a per call basis
-		option.WithoutAuthentication(),
-		// grpc oauth TokenSource credentials require transport security, so
-		// this must be set explicitly even though TLS is used
-		option.WithGRPCDialOption(grpc.WithTransportCredentials(credentials.NewTLS(nil))),
-		// establish a pool of underlying connections to the Secret Manager API
-		// to decrease blocking since same client will be used across concurrent
-		// requests. Note that this is implemented in
-		// google.golang.org/api/option and not grpc itself.
-		option.WithGRPCConnectionPool(*smConnectionPoolSize),
+	insecureEndpoints, err := vars.InsecureEndpoints.GetBooleanValue()
+	if err != nil {
+		klog.ErrorS(err, "failed to get INSECURE_ENDPOINTS flag")
+		klog.Fatal("failed to get INSECURE_ENDPOINTS flag")
 	}
-	if !vars.HasProxyConfigured() {
-		clientOptions = append(clientOptions, option.WithEndpoint("dns:///secretmanager.googleapis.com:443"))
+	transportCreds := credentials.NewTLS(nil)
+	if insecureEndpoints {
+		klog.InfoS("connecting to secretmanager and parametermanager endpoints, and overridden cloudkms and privateca endpoints, without transport security")
+		transportCreds = insecure.NewCredentials()
 	}
-	sc, err := secretmanager.NewClient(ctx, clientOptions...)
+	universeDomain, err := vars.UniverseDomain.GetValue()
+	if err != nil {
+		klog.ErrorS(err, "failed to get universe domain")
+		klog.Fatal("failed to get universe domain")
+	}
+	newClientOptions := func(transportCreds credentials.TransportCredentials) []option.ClientOption {
+		return []option.ClientOption{
+			option.WithUserAgent(ua),
+			option.WithUniverseDomain(universeDomain),
+			// tell the secretmanager library to not add transport-level ADC since
+			// we need to override on a per call basis
+			option.WithoutAuthentication(),
+			// grpc oauth TokenSource credentials require transport security, so
+			// this must be set explicitly even though TLS is used
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(transportCreds)),
+			// establish a pool of underlying connections to the Secret Manager API
+			// to decrease blocking since same client will be used across concurrent
+			// requests. Note that this is implemented in
+			// google.golang.org/api/option and not grpc itself.
+			option.WithGRPCConnectionPool(*smConnectionPoolSize),
+		}
+	}
+	clientOptions := newClientOptions(transportCreds)
+
+	smClientOptions := clientOptions[:len(clientOptions):len(clientOptions)]
+	if smEndpoint := getEndpoint(vars.SecretManagerEndpoint, ""); smEndpoint != "" {
+		smClientOptions = append(smClientOptions, option.WithEndpoint(smEndpoint))
+	} else if !vars.HasProxyConfigured() {
+		smClientOptions = append(smClientOptions, option.WithEndpoint(fmt.Sprintf("dns:///secretmanager.%s:443", universeDomain)))
+	}
+	sc, err := secretmanager.NewClient(ctx, smClientOptions...)
 	if err != nil {
 		klog.ErrorS(err, "failed to create secretmanager client")
 		klog.Fatal("failed to create secretmanager client")
 	}
 
-	pmClientOptions := append(clientOptions, option.WithEndpoint("dns:///parametermanager.googleapis.com:443"))
+	pmEndpoint := getEndpoint(vars.ParameterManagerEndpoint, fmt.Sprintf("dns:///parametermanager.%s:443", universeDomain))
+	pmClientOptions := append(clientOptions[:len(clientOptions):len(clientOptions)], option.WithEndpoint(pmEndpoint))
 	pmClient, err := parametermanager.NewClient(ctx, pmClientOptions...)
 	if err != nil {
 		klog.ErrorS(err, "failed to create parametermanager client")
 		klog.Fatal("failed to create parametermanager client")
 	}
 
-	// Used to store regional clients inside map
-	regionalSmClientMap := make(map[string]*secretmanager.Client)
+	// Only overridden Cloud KMS and CA Service endpoints, i.e. local
+	// emulators, are connected to without transport security.
+	kmsEndpoint, kmsTransportCreds := getEndpoint(vars.CloudKMSEndpoint, ""), transportCreds
+	if kmsEndpoint == "" {
+		kmsEndpoint, kmsTransportCreds = fmt.Sprintf("dns:///cloudkms.%s:443", universeDomain), credentials.NewTLS(nil)
+	}
+	kmsClientOptions := append(newClientOptions(kmsTransportCreds), option.WithEndpoint(kmsEndpoint))
+	kmsClient, err := kms.NewKeyManagementClient(ctx, kmsClientOptions...)
+	if err != nil {
+		klog.ErrorS(err, "failed to create cloudkms client")
+		klog.Fatal("failed to create cloudkms client")
+	}
+
+	caEndpoint, caTransportCreds := getEndpoint(vars.PrivateCAEndpoint, ""), transportCreds
+	if caEndpoint == "" {
+		caEndpoint, caTransportCreds = fmt.Sprintf("dns:///privateca.%s:443", universeDomain), credentials.NewTLS(nil)
+	}
+	caClientOptions := append(newClientOptions(caTransportCreds), option.WithEndpoint(caEndpoint))
+	caClient, err := privateca.NewCertificateAuthorityClient(ctx, caClientOptions...)
+	if err != nil {
+		klog.ErrorS(err, "failed to create privateca client")
+		klog.Fatal("failed to create privateca client")
+	}
+
+	// Regional clients are created on the first mount which references a
+	// resource in their location.
+	smRegionalEndpoint, err := vars.SecretManagerRegionalEndpoint.GetUniverseValue()
+	if err != nil {
+		klog.ErrorS(err, "failed to get secretmanager regional endpoint")
+		klog.Fatal("failed to get secretmanager regional endpoint")
+	}
+	pmRegionalEndpoint, err := vars.ParameterManagerRegionalEndpoint.GetUniverseValue()
+	if err != nil {
+		klog.ErrorS(err, "failed to get parametermanager regional endpoint")
+		klog.Fatal("failed to get parametermanager regional endpoint")
+	}
+	regionalSmClients := server.NewClientRegistry(func(ctx context.Context, location string) (*secretmanager.Client, error) {
+		return util.GetRegionalSecretManagerClient(ctx, location, smRegionalEndpoint, clientOptions)
+	}, *regionalClientIdleTimeout)
+	regionalPmClients := server.NewClientRegistry(func(ctx context.Context, location string) (*parametermanager.Client, error) {
+		return util.GetRegionalParameterManagerClient(ctx, location, pmRegionalEndpoint, clientOptions)
+	}, *regionalClientIdleTimeout)
+	go regionalSmClients.RunIdleEviction(ctx)
+	go regionalPmClients.RunIdleEviction(ctx)
 
-	// To cache the clients for parameter manager regional endpoints
-	regionalPmClientMap := make(map[string]*parametermanager.Client)
 	// IAM client
 	//
 	// build without auth so that authentication can be re-added on a per-RPC
 	// basis for each mount
 	iamOpts := []option.ClientOption{
 		option.WithUserAgent(ua),
+		option.WithUniverseDomain(universeDomain),
 		// tell the secretmanager library to not add transport-level ADC since
 		// we need to override on a per call basis
 		option.WithoutAuthentication(),
@@ -187,11 +288,71 @@ func main() {
 		Timeout: 60 * time.Second,
 	}
 
+	// Cloud Storage objects are downloaded through the JSON API with the
+	// credentials of each mount.
+	storageClient := &server.StorageClient{
+		HTTPClient:    hc,
+		Endpoint:      getEndpoint(vars.StorageEndpoint, fmt.Sprintf("https://storage.%s", universeDomain)),
+		MaxObjectSize: *storageMaxObjectSize,
+	}
+
+	// Outbound API calls are limited across all mounts of the node.
+	limiter := infra.NewLimiter(*maxConcurrentRequests, map[infra.API]infra.RateLimit{
+		infra.APISecretManager:    {QPS: *smQPS, Burst: *smBurst},
+		infra.APIParameterManager: {QPS: *pmQPS, Burst: *pmBurst},
+		infra.APIIAMCredentials:   {QPS: *iamQPS, Burst: *iamBurst},
+		infra.APISTS:              {QPS: *stsQPS, Burst: *stsBurst},
+		infra.APICloudKMS:         {QPS: *kmsQPS, Burst: *kmsBurst},
+		infra.APICloudStorage:     {QPS: *storageQPS, Burst: *storageBurst},
+		infra.APIPrivateCA:        {QPS: *privateCAQPS, Burst: *privateCABurst},
+	})
+
+	var retryPolicy *infra.RetryPolicy
+	if *retryMaxAttempts > 0 {
+		codes, err := infra.ParseCodes(*retryCodes)
+		if err != nil {
+			klog.ErrorS(err, "failed to parse retry_codes")
+			klog.Fatal("failed to parse retry_codes")
+		}
+		retryPolicy = &infra.RetryPolicy{
+			MaxAttempts:    *retryMaxAttempts,
+			InitialBackoff: *retryInitialBackoff,
+			MaxBackoff:     *retryMaxBackoff,
+			Multiplier:     *retryMultiplier,
+			RetryableCodes: codes,
+		}
+	}
+
 	c := &auth.Client{
 		KubeClient:     clientset,
 		IAMClient:      iamc,
 		MetadataClient: metadata.NewClient(hc),
 		HTTPClient:     hc,
+		Limiter:        limiter,
+		RetryPolicy:    retryPolicy,
+	}
+	if *enableTokenCache {
+		c.TokenCache = auth.NewTokenCache()
+	}
+
+	exposePayloadChecksums, err := vars.ExposePayloadChecksums.GetBooleanValue()
+	if err != nil {
+		klog.ErrorS(err, "failed to get EXPOSE_PAYLOAD_CHECKSUMS flag")
+		klog.Fatal("failed to get EXPOSE_PAYLOAD_CHECKSUMS flag")
+	}
+
+	var eventRecorder record.EventRecorder
+	if *staleOnErrorMaxStaleness > 0 {
+		if *payloadCacheSize <= 0 {
+			klog.Fatal("stale_on_error_max_staleness requires payload_cache_size to be set")
+		}
+		klog.InfoS("stale-on-error enabled, payloads may be served stale when fetching fails", "max_staleness", staleOnErrorMaxStaleness.String())
+
+		// A warning event is emitted on pods mounting stale payloads.
+		eventBroadcaster := record.NewBroadcaster(record.WithContext(ctx))
+		eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+		defer eventBroadcaster.Shutdown()
+		eventRecorder = eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: uai})
 	}
 
 	// setup provider grpc server
@@ -199,9 +360,20 @@ func main() {
 		SecretClient:                    sc,
 		ParameterManagerClient:          pmClient,
 		AuthClient:                      c,
-		RegionalSecretClients:           regionalSmClientMap,
-		RegionalParameterManagerClients: regionalPmClientMap,
-		ServerClientOptions:             clientOptions,
+		RegionalSecretClients:           regionalSmClients,
+		RegionalParameterManagerClients: regionalPmClients,
+		KMSClient:                       kmsClient,
+		StorageClient:                   storageClient,
+		CAClient:                        caClient,
+		MaxSelectedSecrets:              *maxSelectedSecrets,
+		Certificates:                    server.NewCertificateStore(),
+		Keystores:                       server.NewKeystoreCache(),
+		InsecureEndpoints:               insecureEndpoints,
+		PayloadCache:                    server.NewPayloadCache(*payloadCacheSize, *payloadCacheTTL, *payloadCachePinnedTTL, *staleOnErrorMaxStaleness),
+		ExposePayloadChecksums:          exposePayloadChecksums,
+		Limiter:                         limiter,
+		RetryPolicy:                     retryPolicy,
+		EventRecorder:                   eventRecorder,
 	}
 
 	p, err := vars.ProviderName.GetValue()
@@ -277,4 +449,25 @@ func main() {
 	<-ctx.Done()
 	klog.InfoS("terminating")
 	g.GracefulStop()
+	if err := s.Close(); err != nil {
+		klog.ErrorS(err, "failed to close secretmanager, parametermanager, cloudkms and privateca clients")
+	}
+	if err := iamc.Close(); err != nil {
+		klog.ErrorS(err, "failed to close iam client")
+	}
+}
+
+// getEndpoint returns the endpoint override configured in ev, falling back to
+// defaultEndpoint.
+func getEndpoint(ev vars.EnvVar, defaultEndpoint string) string {
+	endpoint, err := ev.GetUniverseValue()
+	if err != nil {
+		klog.ErrorS(err, "failed to get endpoint override")
+		klog.Fatal("failed to get endpoint override")
+	}
+	if endpoint == "" {
+		return defaultEndpoint
+	}
+	klog.InfoS("using endpoint override", "endpoint", endpoint)
+	return endpoint
 }
@@ -0,0 +1,148 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	privateca "cloud.google.com/go/security/privateca/apiv1"
+	"cloud.google.com/go/security/privateca/apiv1/privatecapb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/infra"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/util"
+	"github.com/google/uuid"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// IssueCertificates issues a certificate from the CA pool of the resource for
+// a private key generated on the node, or reuses the certificate issued for
+// the same pod until it is due for renewal. The key, certificate and chain
+// are split into files like a "pem" entry.
+func (r *resourceFetcher) IssueCertificates(ctx context.Context, authOption *gax.CallOption, caClient *privateca.CertificateAuthorityClient, resultChan chan<- *Resource) {
+	key := r.certificateKey()
+	issued, ok := r.Certificates.get(key)
+	if !ok {
+		var err error
+		if issued, err = r.createCertificate(ctx, authOption, caClient); err != nil {
+			resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+			return
+		}
+		r.Certificates.add(key, issued)
+	}
+	r.Format = util.FormatPEM
+	resultChan <- r.buildResource(ctx, authOption, issued.bundle, issued.version)
+}
+
+// certificateKey identifies the certificates of the entry for the mounting
+// pod in the CertificateStore.
+func (r *resourceFetcher) certificateKey() string {
+	request, _ := json.Marshal(r.Certificate)
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s\x00%s\x00%s\x00%s\x00%s", r.Identity, r.PodUID, r.ResourceURI, r.Path, request))
+	return hex.EncodeToString(sum[:])
+}
+
+// createCertificate generates a private key and has Certificate Authority
+// Service sign a certificate for it.
+func (r *resourceFetcher) createCertificate(ctx context.Context, authOption *gax.CallOption, caClient *privateca.CertificateAuthorityClient) (*issuedCertificate, error) {
+	certificate := &privatecapb.Certificate{}
+	var keyPEM, csrPEM []byte
+	var err error
+	if c := r.Certificate; c != nil {
+		certificate.CertificateTemplate = c.Template
+		if c.Lifetime != "" {
+			lifetime, err := time.ParseDuration(c.Lifetime)
+			if err != nil {
+				return nil, fmt.Errorf("invalid certificate lifetime '%s': %v", c.Lifetime, err)
+			}
+			certificate.Lifetime = durationpb.New(lifetime)
+		}
+		keyPEM, csrPEM, err = util.NewCertificateRequest(c.KeyAlgorithm, c.CommonName, c.DNSNames)
+	} else {
+		keyPEM, csrPEM, err = util.NewCertificateRequest("", "", nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	certificate.CertificateConfig = &privatecapb.Certificate_PemCsr{PemCsr: string(csrPEM)}
+	// The request ID makes retries of the same request idempotent.
+	request := &privatecapb.CreateCertificateRequest{
+		Parent:        r.ResourceURI,
+		CertificateId: "csi-" + uuid.NewString(),
+		Certificate:   certificate,
+		RequestId:     uuid.NewString(),
+	}
+	callOptions := []gax.CallOption{*authOption}
+	if r.Retry != nil {
+		callOptions = append(callOptions, infra.WithoutSDKRetries)
+	}
+	var response *privatecapb.Certificate
+	err = r.Retry.Do(ctx, "CreateCertificate", func() error {
+		release, err := r.Limiter.Acquire(ctx, infra.APIPrivateCA)
+		if err != nil {
+			return err
+		}
+		defer release()
+		caMetricRecorder := csrmetrics.OutboundRPCStartRecorder(r.MetricName)
+		response, err = caClient.CreateCertificate(ctx, request, callOptions...)
+		if err != nil {
+			caMetricRecorder(csrmetrics.OutboundRPCStatus(status.Code(err).String()))
+			return err
+		}
+		caMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(response.GetPemCertificate()))
+	if block == nil {
+		return nil, status.Error(codes.Internal, "issued certificate is not PEM encoded")
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to parse issued certificate: %v", err))
+	}
+	var bundle strings.Builder
+	bundle.Write(keyPEM)
+	bundle.WriteString(ensureTrailingNewline(response.GetPemCertificate()))
+	for _, c := range response.GetPemCertificateChain() {
+		bundle.WriteString(ensureTrailingNewline(c))
+	}
+	return &issuedCertificate{
+		bundle:   []byte(bundle.String()),
+		version:  fmt.Sprintf("%s/%s", leaf.SerialNumber.Text(16), leaf.NotAfter.UTC().Format(time.RFC3339)),
+		renewAt:  leaf.NotBefore.Add(leaf.NotAfter.Sub(leaf.NotBefore) * 2 / 3),
+		notAfter: leaf.NotAfter,
+	}, nil
+}
+
+func ensureTrailingNewline(s string) string {
+	if strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
@@ -0,0 +1,91 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+)
+
+const certificateStoreMetricName = "certificate"
+
+// CertificateStore keeps the certificates issued by Certificate Authority
+// Service together with their private keys, so that rotation only re-issues a
+// certificate once two thirds of its lifetime have passed.
+//
+// Private keys never leave the node, so a certificate issued before the
+// provider restarted cannot be served again and is re-issued on the next
+// mount.
+type CertificateStore struct {
+	mu    sync.Mutex
+	certs map[string]*issuedCertificate
+
+	// now is replaced in unit tests.
+	now func() time.Time
+}
+
+// issuedCertificate is the PEM bundle of a private key, its certificate and
+// the chain of the certificate.
+type issuedCertificate struct {
+	bundle   []byte
+	version  string
+	renewAt  time.Time
+	notAfter time.Time
+}
+
+// NewCertificateStore returns an empty CertificateStore.
+func NewCertificateStore() *CertificateStore {
+	return &CertificateStore{
+		certs: make(map[string]*issuedCertificate),
+		now:   time.Now,
+	}
+}
+
+// get returns the certificate stored for key unless it is due for renewal.
+func (s *CertificateStore) get(key string) (*issuedCertificate, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.certs[key]
+	if !ok || !s.now().Before(c.renewAt) {
+		csrmetrics.RecordCacheLookup(certificateStoreMetricName, csrmetrics.CacheMiss)
+		return nil, false
+	}
+	csrmetrics.RecordCacheLookup(certificateStoreMetricName, csrmetrics.CacheHit)
+	return c, true
+}
+
+// add stores the certificate issued for key and drops the expired
+// certificates of mounts which are gone.
+func (s *CertificateStore) add(key string, c *issuedCertificate) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, old := range s.certs {
+		if !now.Before(old.notAfter) {
+			delete(s.certs, k)
+		}
+	}
+	s.certs[key] = c
+}
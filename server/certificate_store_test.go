@@ -0,0 +1,56 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCertificateStore(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	s := NewCertificateStore()
+	s.now = func() time.Time { return now }
+
+	s.add("a", &issuedCertificate{version: "1", renewAt: now.Add(2 * time.Hour), notAfter: now.Add(3 * time.Hour)})
+	s.add("b", &issuedCertificate{version: "2", renewAt: now.Add(time.Hour), notAfter: now.Add(90 * time.Minute)})
+
+	if c, ok := s.get("a"); !ok || c.version != "1" {
+		t.Errorf("get(a) = %v, %v, want version 1", c, ok)
+	}
+	if _, ok := s.get("c"); ok {
+		t.Errorf("get(c) = _, true, want false")
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok := s.get("b"); ok {
+		t.Errorf("get(b) after renewAt = _, true, want certificate to be due for renewal")
+	}
+
+	now = now.Add(time.Hour)
+	s.add("c", &issuedCertificate{version: "3", renewAt: now.Add(time.Hour), notAfter: now.Add(2 * time.Hour)})
+	if _, ok := s.certs["b"]; ok {
+		t.Errorf("add() kept the expired certificate of b")
+	}
+	if _, ok := s.certs["a"]; !ok {
+		t.Errorf("add() dropped the unexpired certificate of a")
+	}
+
+	var nilStore *CertificateStore
+	nilStore.add("a", &issuedCertificate{})
+	if _, ok := nilStore.get("a"); ok {
+		t.Errorf("nil CertificateStore get() = _, true, want false")
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// ClientRegistry lazily creates one API client per location and shares it
+// across concurrent mounts.
+type ClientRegistry[C io.Closer] struct {
+	newClient   func(ctx context.Context, location string) (C, error)
+	idleTimeout time.Duration
+
+	// mu only guards clients, clients are created without holding it.
+	mu      sync.Mutex
+	clients map[string]*registeredClient[C]
+
+	// now is replaced in unit tests.
+	now func() time.Time
+}
+
+type registeredClient[C io.Closer] struct {
+	// ready is closed once client and err are set.
+	ready  chan struct{}
+	client C
+	err    error
+
+	// users is the number of callers of Get which have not released the
+	// client yet. Clients in use are never evicted.
+	users    int
+	lastUsed time.Time
+}
+
+// NewClientRegistry returns a ClientRegistry which uses newClient to create
+// the client of a location the first time it is requested. If idleTimeout is
+// positive, clients which have not been used for that long are closed by
+// EvictIdle.
+func NewClientRegistry[C io.Closer](newClient func(ctx context.Context, location string) (C, error), idleTimeout time.Duration) *ClientRegistry[C] {
+	return &ClientRegistry[C]{
+		newClient:   newClient,
+		idleTimeout: idleTimeout,
+		clients:     make(map[string]*registeredClient[C]),
+		now:         time.Now,
+	}
+}
+
+// Get returns the client for location, creating it if needed. Concurrent
+// callers for the same location share a single client, while the creation of
+// the client of one location does not block callers for other locations.
+//
+// The returned release function must be called once the client is no longer
+// used, so that it can be evicted when idle.
+func (r *ClientRegistry[C]) Get(ctx context.Context, location string) (C, func(), error) {
+	r.mu.Lock()
+	rc, ok := r.clients[location]
+	if !ok {
+		rc = &registeredClient[C]{ready: make(chan struct{})}
+		r.clients[location] = rc
+	}
+	rc.users++
+	r.mu.Unlock()
+
+	if !ok {
+		// The client outlives the mount that created it, so it must not be
+		// tied to the cancellation of the mount request.
+		rc.client, rc.err = r.newClient(context.WithoutCancel(ctx), location)
+		if rc.err != nil {
+			// Failures are not cached, the next caller tries again.
+			r.mu.Lock()
+			delete(r.clients, location)
+			r.mu.Unlock()
+		}
+		close(rc.ready)
+	}
+
+	var zero C
+	select {
+	case <-rc.ready:
+	case <-ctx.Done():
+		r.release(rc)
+		return zero, nil, ctx.Err()
+	}
+	if rc.err != nil {
+		r.release(rc)
+		return zero, nil, rc.err
+	}
+	return rc.client, sync.OnceFunc(func() { r.release(rc) }), nil
+}
+
+func (r *ClientRegistry[C]) release(rc *registeredClient[C]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rc.users--
+	rc.lastUsed = r.now()
+}
+
+// EvictIdle closes and removes the clients which are not in use and have not
+// been used within the idle timeout.
+func (r *ClientRegistry[C]) EvictIdle() {
+	if r.idleTimeout <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for location, rc := range r.clients {
+		if rc.users > 0 || r.now().Sub(rc.lastUsed) < r.idleTimeout {
+			continue
+		}
+		klog.V(3).InfoS("closing idle regional client", "location", location)
+		if err := rc.client.Close(); err != nil {
+			klog.ErrorS(err, "failed to close idle regional client", "location", location)
+		}
+		delete(r.clients, location)
+	}
+}
+
+// RunIdleEviction periodically calls EvictIdle until ctx is done. It returns
+// immediately if no idle timeout is configured.
+func (r *ClientRegistry[C]) RunIdleEviction(ctx context.Context) {
+	if r.idleTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.EvictIdle()
+		}
+	}
+}
+
+// Close closes all clients of the registry.
+func (r *ClientRegistry[C]) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for location, rc := range r.clients {
+		select {
+		case <-rc.ready:
+			errs = append(errs, rc.client.Close())
+		default:
+			// Clients still being created are not closed.
+		}
+		delete(r.clients, location)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,201 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+)
+
+type fakeClient struct {
+	location string
+	closed   bool
+}
+
+func (f *fakeClient) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestClientRegistryGet(t *testing.T) {
+	var mu sync.Mutex
+	created := make(map[string]int)
+	r := NewClientRegistry(func(_ context.Context, location string) (*fakeClient, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		created[location]++
+		return &fakeClient{location: location}, nil
+	}, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(location string) {
+			defer wg.Done()
+			c, release, err := r.Get(context.Background(), location)
+			if err != nil {
+				t.Errorf("Get(%q) got err = %v, want err = nil", location, err)
+				return
+			}
+			defer release()
+			if c.location != location {
+				t.Errorf("Get(%q) returned client for %q", location, c.location)
+			}
+		}([]string{"us-central1", "europe-west1"}[i%2])
+	}
+	wg.Wait()
+
+	for _, location := range []string{"us-central1", "europe-west1"} {
+		if created[location] != 1 {
+			t.Errorf("client for %q created %d times, want 1", location, created[location])
+		}
+	}
+}
+
+func TestClientRegistryGetError(t *testing.T) {
+	r := NewClientRegistry(func(_ context.Context, location string) (*fakeClient, error) {
+		return nil, errors.New("simulated NewClient error")
+	}, 0)
+
+	if _, _, err := r.Get(context.Background(), "us-central1"); err == nil {
+		t.Errorf("Get() got err = nil, want error")
+	}
+}
+
+func TestClientRegistryGetDoesNotBlockOtherLocations(t *testing.T) {
+	unblock := make(chan struct{})
+	r := NewClientRegistry(func(_ context.Context, location string) (*fakeClient, error) {
+		if location == "slow" {
+			<-unblock
+		}
+		return &fakeClient{location: location}, nil
+	}, 0)
+	defer close(unblock)
+
+	go r.Get(context.Background(), "slow")
+	for {
+		r.mu.Lock()
+		_, ok := r.clients["slow"]
+		r.mu.Unlock()
+		if ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, release, err := r.Get(ctx, "fast")
+	if err != nil {
+		t.Fatalf("Get(fast) got err = %v while another location is created, want err = nil", err)
+	}
+	release()
+	if c.location != "fast" {
+		t.Errorf("Get(fast) returned client for %q", c.location)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := r.Get(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get(slow) got err = %v, want deadline exceeded", err)
+	}
+}
+
+func TestClientRegistryEvictIdle(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	r := NewClientRegistry(func(_ context.Context, location string) (*fakeClient, error) {
+		return &fakeClient{location: location}, nil
+	}, time.Hour)
+	r.now = func() time.Time { return now }
+
+	idle, release, _ := r.Get(context.Background(), "us-central1")
+	release()
+	inUse, _, _ := r.Get(context.Background(), "asia-east1")
+	now = now.Add(30 * time.Minute)
+	active, release, _ := r.Get(context.Background(), "europe-west1")
+	release()
+	now = now.Add(45 * time.Minute)
+
+	r.EvictIdle()
+	if !idle.closed {
+		t.Errorf("idle client was not closed")
+	}
+	if active.closed {
+		t.Errorf("active client was closed")
+	}
+	if inUse.closed {
+		t.Errorf("client in use was closed")
+	}
+	if c, release, _ := r.Get(context.Background(), "us-central1"); c == idle {
+		t.Errorf("Get() returned evicted client, want a new client")
+	} else {
+		release()
+	}
+
+	if err := r.Close(); err != nil {
+		t.Errorf("Close() got err = %v, want err = nil", err)
+	}
+	if !active.closed || !inUse.closed {
+		t.Errorf("Close() did not close all clients")
+	}
+}
+
+func TestHandleMountEventRegionalClientError(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/test/versions/latest",
+				FileName:     "good1.txt",
+			},
+			{
+				ResourceName: "projects/project/locations/us-central1/secrets/test/versions/latest",
+				FileName:     "good2.txt",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    "projects/project/secrets/test/versions/2",
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+
+	server := &Server{
+		SecretClient: client,
+		RegionalSecretClients: NewClientRegistry(func(_ context.Context, location string) (*secretmanager.Client, error) {
+			return nil, errors.New("simulated NewClient error")
+		}, 0),
+	}
+	_, got := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if got == nil || !strings.Contains(got.Error(), "simulated NewClient error") {
+		t.Errorf("handleMountEvent() got err = %v, want regional client creation error", got)
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// templateData holds the inputs of the composite entries of a mount.
+type templateData struct {
+	// values maps each alias to the payload of its entry, or to a map of file
+	// name to payload for fanned out entries.
+	values map[string]any
+	// versions maps each alias to the version of its entry.
+	versions map[string]string
+}
+
+// newTemplateData collects the payloads of the aliased entries of cfg from
+// resultMap. It returns false if any of them failed, in which case the mount
+// fails anyway and there is nothing to render.
+func newTemplateData(cfg *config.MountConfig, resultMap map[resourceIdentity]*Resource, omitted map[resourceIdentity]bool) (*templateData, bool) {
+	data := &templateData{values: make(map[string]any), versions: make(map[string]string)}
+	for _, secret := range cfg.Secrets {
+		if secret.Alias == "" {
+			continue
+		}
+		resourceKey := resourceIdentity{secret.ResourceName, secret.FileName, secret.Path}
+		if omitted[resourceKey] {
+			continue
+		}
+		resource, ok := resultMap[resourceKey]
+		if !ok || resource.Err != nil {
+			return nil, false
+		}
+		if len(resource.Files) > 0 {
+			files := make(map[string]string, len(resource.Files))
+			for _, f := range resource.Files {
+				files[f.Name] = string(f.Payload)
+			}
+			data.values[secret.Alias] = files
+		} else {
+			data.values[secret.Alias] = string(resource.Payload)
+		}
+		data.versions[secret.Alias] = resource.Version
+	}
+	return data, true
+}
+
+// version is the composite of the versions of the given aliases, or of all
+// aliases if all is set. Aliases of omitted optional entries are left out.
+func (d *templateData) version(aliases []string, all bool) string {
+	if all {
+		aliases = slices.Collect(maps.Keys(d.versions))
+	}
+	var versions []string
+	for _, alias := range aliases {
+		if v, ok := d.versions[alias]; ok && !slices.Contains(versions, alias+"="+v) {
+			versions = append(versions, alias+"="+v)
+		}
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, ",")
+}
+
+// compositeInputs returns the aliases secret is rendered from. all is set if
+// they cannot be determined, e.g. when a template passes the whole data to a
+// function.
+func compositeInputs(secret *config.Secret) (aliases []string, all bool) {
+	if secret.Template == "" {
+		aliases = slices.Clone(secret.Aliases)
+		if secret.PasswordAlias != "" {
+			aliases = append(aliases, secret.PasswordAlias)
+		}
+		return aliases, false
+	}
+	tmpl, err := template.New(secret.PathString()).Parse(secret.Template)
+	if err != nil {
+		return nil, true
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		if !templateFields(t.Tree.Root, false, &aliases) {
+			return nil, true
+		}
+	}
+	return aliases, false
+}
+
+// templateFields appends the first identifier of the fields of the data
+// referenced by node, i.e. "db" for {{ .db.password }} or {{ $.db }}, to
+// fields. Within the body of range and with blocks, where the dot is another
+// value, only the fields referenced through $ are appended. It returns false
+// if node references the data as a whole, e.g. {{ . }} or {{ index . "db" }}.
+func templateFields(node parse.Node, rebound bool, fields *[]string) bool {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return rebound
+	case *parse.FieldNode:
+		if !rebound {
+			*fields = append(*fields, n.Ident[0])
+		}
+		return true
+	case *parse.VariableNode:
+		if n.Ident[0] != "$" {
+			return true
+		}
+		if len(n.Ident) < 2 {
+			return false
+		}
+		*fields = append(*fields, n.Ident[1])
+		return true
+	case *parse.ChainNode:
+		return templateFields(n.Node, rebound, fields)
+	case *parse.ListNode:
+		if n == nil {
+			return true
+		}
+		for _, child := range n.Nodes {
+			if !templateFields(child, rebound, fields) {
+				return false
+			}
+		}
+		return true
+	case *parse.ActionNode:
+		return templateFields(n.Pipe, rebound, fields)
+	case *parse.TemplateNode:
+		return templateFields(n.Pipe, rebound, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return true
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if !templateFields(arg, rebound, fields) {
+					return false
+				}
+			}
+		}
+		return true
+	case *parse.IfNode:
+		return templateFields(n.Pipe, rebound, fields) && templateFields(n.List, rebound, fields) && templateFields(n.ElseList, rebound, fields)
+	case *parse.RangeNode:
+		return templateFields(n.Pipe, rebound, fields) && templateFields(n.List, true, fields) && templateFields(n.ElseList, rebound, fields)
+	case *parse.WithNode:
+		return templateFields(n.Pipe, rebound, fields) && templateFields(n.List, true, fields) && templateFields(n.ElseList, rebound, fields)
+	default:
+		return true
+	}
+}
+
+// renderComposites renders the composite entries of cfg into resultMap. Each
+// rendered file is versioned by the aliased entries it is rendered from so
+// that the rotation of any of its inputs is detected.
+func renderComposites(cfg *config.MountConfig, resultMap map[resourceIdentity]*Resource, omitted map[resourceIdentity]bool, keystores *KeystoreCache) {
+	var data *templateData
+	for _, secret := range cfg.Secrets {
+		if !secret.IsComposite() {
+			continue
+		}
+		if data == nil {
+			var ok bool
+			if data, ok = newTemplateData(cfg, resultMap, omitted); !ok {
+				return
+			}
+		}
+		resourceKey := resourceIdentity{secret.ResourceName, secret.FileName, secret.Path}
+		id := objectID(secret)
+		var payload []byte
+		var err error
+		switch {
+		case secret.Template != "":
+			payload, err = renderTemplate(secret, data)
+		case util.IsKeystoreFormat(secret.Format):
+			payload, err = renderKeystore(secret, data, keystores)
+		default:
+			payload, err = renderDotenv(secret, data)
+		}
+		if err != nil {
+			resultMap[resourceKey] = getErrorResource(id, secret.FileName, secret.Path, status.Error(codes.InvalidArgument, err.Error()))
+			continue
+		}
+		resultMap[resourceKey] = &Resource{
+			ID:       id,
+			FileName: secret.FileName,
+			Path:     secret.Path,
+			Version:  data.version(compositeInputs(secret)),
+			Payload:  payload,
+			Checksum: crc32.Checksum(payload, crc32cTable),
+		}
+	}
+}
+
+// renderTemplate executes the template of secret.
+func renderTemplate(secret *config.Secret, data *templateData) ([]byte, error) {
+	tmpl, err := template.New(secret.PathString()).Option("missingkey=error").Parse(secret.Template)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data.values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderDotenv writes the payloads of the aliases of secret as an env file.
+// Aliases of fanned out entries contribute one variable per file, others one
+// variable named after the alias. Aliases of omitted optional entries are
+// left out.
+func renderDotenv(secret *config.Secret, data *templateData) ([]byte, error) {
+	var vars []util.EnvVar
+	for _, alias := range secret.Aliases {
+		switch v := data.values[alias].(type) {
+		case string:
+			vars = append(vars, util.EnvVar{Name: alias, Value: []byte(v)})
+		case map[string]string:
+			for _, name := range slices.Sorted(maps.Keys(v)) {
+				vars = append(vars, util.EnvVar{Name: name, Value: []byte(v[name])})
+			}
+		}
+	}
+	return util.RenderDotenv(vars)
+}
+
+// renderKeystore builds a keystore of the PEM material of the aliases of
+// secret. Fanned out entries, such as those of the pem format, contribute all
+// of their files. A trailing newline of the password is ignored.
+func renderKeystore(secret *config.Secret, data *templateData, keystores *KeystoreCache) ([]byte, error) {
+	var bundle []byte
+	for _, alias := range secret.Aliases {
+		switch v := data.values[alias].(type) {
+		case string:
+			bundle = append(bundle, v...)
+			bundle = append(bundle, '\n')
+		case map[string]string:
+			for _, name := range slices.Sorted(maps.Keys(v)) {
+				bundle = append(bundle, v[name]...)
+				bundle = append(bundle, '\n')
+			}
+		}
+	}
+	password, ok := data.values[secret.PasswordAlias].(string)
+	if !ok {
+		return nil, fmt.Errorf("password alias %q of keystore %q is not a single value", secret.PasswordAlias, secret.PathString())
+	}
+	password = strings.TrimRight(password, "\r\n")
+	key := keystoreCacheKey(secret.Format, bundle, password)
+	if keystore, ok := keystores.get(key); ok {
+		return keystore, nil
+	}
+	keystore, err := util.BuildKeystore(bundle, password, secret.Format)
+	if err != nil {
+		return nil, err
+	}
+	keystores.add(key, keystore)
+	return keystore, nil
+}
+
+// objectID is the ObjectVersion Id of the file of secret.
+func objectID(secret *config.Secret) string {
+	switch {
+	case secret.Template != "":
+		return "template:" + secret.PathString()
+	case secret.IsComposite():
+		return secret.Format + ":" + secret.PathString()
+	default:
+		return secret.ResourceName
+	}
+}
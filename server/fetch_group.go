@@ -0,0 +1,65 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "sync"
+
+// fetchGroup collapses the fetches of the same resource within a single mount
+// into one API call, so that every file derived from a resource is written
+// from the same payload and version even while the resource is rotated.
+type fetchGroup struct {
+	mu      sync.Mutex
+	fetches map[string]*fetchResult
+}
+
+type fetchResult struct {
+	done    chan struct{}
+	payload *fetchedPayload
+	err     error
+}
+
+// fetchedPayload is the raw content of a resource as returned by the API.
+type fetchedPayload struct {
+	data    []byte
+	version string
+	// stale is set if data was served from the PayloadCache after fetching
+	// failed.
+	stale bool
+}
+
+func newFetchGroup() *fetchGroup {
+	return &fetchGroup{fetches: make(map[string]*fetchResult)}
+}
+
+// do calls fetch for the first caller of key and returns its result to every
+// caller of key. A nil fetchGroup calls fetch every time.
+func (g *fetchGroup) do(key string, fetch func() (*fetchedPayload, error)) (*fetchedPayload, error) {
+	if g == nil {
+		return fetch()
+	}
+	g.mu.Lock()
+	if f, ok := g.fetches[key]; ok {
+		g.mu.Unlock()
+		<-f.done
+		return f.payload, f.err
+	}
+	f := &fetchResult{done: make(chan struct{})}
+	g.fetches[key] = f
+	g.mu.Unlock()
+
+	defer close(f.done)
+	f.payload, f.err = fetch()
+	return f.payload, f.err
+}
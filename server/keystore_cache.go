@@ -0,0 +1,107 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+)
+
+const (
+	keystoreCacheMetricName = "keystore"
+
+	// keystoreIdleTTL is how long keystores which are not rendered by any
+	// mount are kept.
+	keystoreIdleTTL = time.Hour
+)
+
+// KeystoreCache keeps the keystores rendered for the keystore composites of
+// the mounts. Keystores are encrypted with random salts, so rendering the same
+// inputs twice yields different bytes, which would rewrite the mounted file on
+// every rotation poll. Keystores are keyed by a digest of their format,
+// contents and password, so the bytes rendered last are reused until any of
+// them changes.
+type KeystoreCache struct {
+	mu        sync.Mutex
+	keystores map[string]*renderedKeystore
+
+	// now is replaced in unit tests.
+	now func() time.Time
+}
+
+type renderedKeystore struct {
+	keystore []byte
+	lastUsed time.Time
+}
+
+// NewKeystoreCache returns an empty KeystoreCache.
+func NewKeystoreCache() *KeystoreCache {
+	return &KeystoreCache{
+		keystores: make(map[string]*renderedKeystore),
+		now:       time.Now,
+	}
+}
+
+// keystoreCacheKey identifies a keystore of format holding bundle protected by
+// password.
+func keystoreCacheKey(format string, bundle []byte, password string) string {
+	h := sha256.New()
+	for _, b := range [][]byte{[]byte(format), bundle, []byte(password)} {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(b))))
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns the keystore rendered for key.
+func (c *KeystoreCache) get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k, ok := c.keystores[key]
+	if !ok {
+		csrmetrics.RecordCacheLookup(keystoreCacheMetricName, csrmetrics.CacheMiss)
+		return nil, false
+	}
+	k.lastUsed = c.now()
+	csrmetrics.RecordCacheLookup(keystoreCacheMetricName, csrmetrics.CacheHit)
+	return k.keystore, true
+}
+
+// add stores the keystore rendered for key and drops the keystores which were
+// not rendered for keystoreIdleTTL.
+func (c *KeystoreCache) add(key string, keystore []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for k, old := range c.keystores {
+		if now.Sub(old.lastUsed) >= keystoreIdleTTL {
+			delete(c.keystores, k)
+		}
+	}
+	c.keystores[key] = &renderedKeystore{keystore: keystore, lastUsed: now}
+}
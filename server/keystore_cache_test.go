@@ -0,0 +1,63 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeystoreCache(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := NewKeystoreCache()
+	c.now = func() time.Time { return now }
+
+	a := keystoreCacheKey("pkcs12", []byte("bundle"), "changeit")
+	b := keystoreCacheKey("jks", []byte("bundle"), "changeit")
+	for _, other := range []string{
+		b,
+		keystoreCacheKey("pkcs12", []byte("bundle"), "rotated"),
+		keystoreCacheKey("pkcs12", []byte("bundle2"), "changeit"),
+		keystoreCacheKey("pkcs12", []byte("bundlechangeit"), ""),
+	} {
+		if other == a {
+			t.Errorf("keystoreCacheKey() got the same key for different inputs")
+		}
+	}
+
+	c.add(a, []byte("a"))
+	c.add(b, []byte("b"))
+	if got, ok := c.get(a); !ok || string(got) != "a" {
+		t.Errorf("get(a) = %q, %v, want a", got, ok)
+	}
+
+	// a is kept as it is still rendered, while b is dropped once idle.
+	now = now.Add(keystoreIdleTTL / 2)
+	c.get(a)
+	now = now.Add(keystoreIdleTTL / 2)
+	c.add("c", []byte("c"))
+	if _, ok := c.keystores[b]; ok {
+		t.Errorf("add() kept the idle keystore b")
+	}
+	if _, ok := c.keystores[a]; !ok {
+		t.Errorf("add() dropped the keystore a in use")
+	}
+
+	var nilCache *KeystoreCache
+	nilCache.add(a, []byte("a"))
+	if _, ok := nilCache.get(a); ok {
+		t.Errorf("nil KeystoreCache get() = _, true, want false")
+	}
+}
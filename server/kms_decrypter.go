@@ -0,0 +1,97 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/infra"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// KMSDecrypt decrypts the ciphertext with the CryptoKey of the kmsDecrypt
+// option of the resource. The CRC32C checksums of the ciphertext and the
+// plaintext are verified so that corruption in transit is detected.
+func (r *resourceFetcher) KMSDecrypt(ctx context.Context, authOption *gax.CallOption, kmsClient *kms.KeyManagementClient, ciphertext []byte) ([]byte, error) {
+	request := &kmspb.DecryptRequest{
+		Name:             r.KMSKey,
+		Ciphertext:       ciphertext,
+		CiphertextCrc32C: wrapperspb.Int64(int64(crc32.Checksum(ciphertext, crc32cTable))),
+	}
+	callOptions := []gax.CallOption{*authOption}
+	if r.Retry != nil {
+		callOptions = append(callOptions, infra.WithoutSDKRetries)
+	}
+	var response *kmspb.DecryptResponse
+	err := r.Retry.Do(ctx, "Decrypt", func() error {
+		release, err := r.Limiter.Acquire(ctx, infra.APICloudKMS)
+		if err != nil {
+			return err
+		}
+		defer release()
+		kmsMetricRecorder := csrmetrics.OutboundRPCStartRecorder("cloudkms_decrypt_requests")
+		response, err = kmsClient.Decrypt(ctx, request, callOptions...)
+		if err != nil {
+			kmsMetricRecorder(csrmetrics.OutboundRPCStatus(status.Code(err).String()))
+			return err
+		}
+		kmsMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if response.PlaintextCrc32C != nil && int64(crc32.Checksum(response.GetPlaintext(), crc32cTable)) != response.GetPlaintextCrc32C().GetValue() {
+		return nil, status.Error(codes.DataLoss, fmt.Sprintf("plaintext checksum mismatch for %s", r.KMSKey))
+	}
+	return response.GetPlaintext(), nil
+}
+
+// decrypt applies the kmsDecrypt option of the resource to content. The
+// plaintext is shared by the entries of the mount decrypting the same
+// ciphertext and cached for the identity of the mount like a fetched payload,
+// so that a ciphertext is not decrypted again until the cached entry expires.
+func (r *resourceFetcher) decrypt(ctx context.Context, authOption *gax.CallOption, content []byte) ([]byte, error) {
+	if content == nil {
+		return nil, nil
+	}
+	sum := sha256.Sum256(content)
+	key := fmt.Sprintf("%s#kms:%s:%s", r.ResourceURI, r.KMSKey, hex.EncodeToString(sum[:]))
+	decrypted, err := r.Fetches.do(key, func() (*fetchedPayload, error) {
+		if plaintext, _, ok := r.Cache.get(r.Identity, key); ok {
+			return &fetchedPayload{data: plaintext}, nil
+		}
+		plaintext, err := r.KMSDecrypt(ctx, authOption, r.KMSClient, content)
+		if err != nil {
+			return nil, err
+		}
+		r.Cache.add(r.Identity, key, plaintext, "")
+		return &fetchedPayload{data: plaintext}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload with %s: %w", r.KMSKey, err)
+	}
+	return decrypted.data, nil
+}
@@ -7,80 +7,119 @@ import (
 	parametermanager "cloud.google.com/go/parametermanager/apiv1"
 	"cloud.google.com/go/parametermanager/apiv1/parametermanagerpb"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
-	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/util"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/infra"
 	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-// This method calls the RenderAPI of parameter manager and stores the result in
-// Resource chan where we store the resourceID and payload (also error if any)
+// This method calls the RenderAPI of parameter manager, or the GetAPI if Raw is
+// set, and stores the result in Resource chan where we store the resourceID and
+// payload (also error if any)
 func (r *resourceFetcher) FetchParameterVersions(ctx context.Context, authOption *gax.CallOption, pmClient *parametermanager.Client, resultChan chan<- *Resource) {
-	pmMetricRecorder := csrmetrics.OutboundRPCStartRecorder(r.MetricName)
-	request := &parametermanagerpb.RenderParameterVersionRequest{
-		Name: r.ResourceURI,
-	}
-	response, err := pmClient.RenderParameterVersion(ctx, request, *authOption)
-	if err != nil {
-		if e, ok := status.FromError(err); ok {
-			pmMetricRecorder(csrmetrics.OutboundRPCStatus(e.Code().String()))
-		} else {
-			// TODO: Keeping the same current implementation ->
-			// But should we keep the status as okay when we have encountered an error?
-			// In my opininon we should throw a default 500 error (rare case)
-			pmMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+	fetched, err := r.Fetches.do(r.cacheKey(), func() (*fetchedPayload, error) {
+		fetch := r.renderParameterVersion
+		if r.Raw {
+			fetch = r.getParameterVersion
 		}
+		payload, version, err := fetch(ctx, authOption, pmClient)
+		if err != nil {
+			return r.staleFallback(infra.APIParameterManager, err)
+		}
+		return &fetchedPayload{data: payload, version: version}, nil
+	})
+	if err != nil {
 		resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
 		return
 	}
-	pmMetricRecorder(csrmetrics.OutboundRPCStatusOK)
-	// Both simultaneously can't be populated.
-	if len(r.ExtractJSONKey) > 0 && len(r.ExtractYAMLKey) > 0 {
-		resultChan <- getErrorResource(
-			r.ResourceURI,
-			r.FileName,
-			r.Path,
-			fmt.Errorf("both ExtractJSONKey and ExtractYAMLKey can't be simultaneously non empty strings"),
-		)
-		return
+	resource := r.buildResource(ctx, authOption, fetched.data, fetched.version)
+	resource.Stale = fetched.stale
+	resultChan <- resource
+}
+
+// renderParameterVersion returns the rendered payload and name of the
+// parameter version, from the PayloadCache if possible.
+func (r *resourceFetcher) renderParameterVersion(ctx context.Context, authOption *gax.CallOption, pmClient *parametermanager.Client) ([]byte, string, error) {
+	if payload, version, ok := r.Cache.get(r.Identity, r.cacheKey()); ok {
+		return payload, version, nil
+	}
+	request := &parametermanagerpb.RenderParameterVersionRequest{
+		Name: r.ResourceURI,
 	}
-	if len(r.ExtractJSONKey) > 0 { // ExtractJSONKey populated
-		content, err := util.ExtractContentUsingJSONKey(response.RenderedPayload, r.ExtractJSONKey)
+	callOptions := []gax.CallOption{*authOption}
+	if r.Retry != nil {
+		callOptions = append(callOptions, infra.WithoutSDKRetries)
+	}
+	var response *parametermanagerpb.RenderParameterVersionResponse
+	err := r.Retry.Do(ctx, "RenderParameterVersion", func() error {
+		release, err := r.Limiter.Acquire(ctx, infra.APIParameterManager)
 		if err != nil {
-			resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
-			return
+			return err
 		}
-		resultChan <- &Resource{
-			ID:       r.ResourceURI,
-			FileName: r.FileName,
-			Path:     r.Path,
-			Version:  response.GetParameterVersion(),
-			Payload:  content,
-			Err:      nil,
+		defer release()
+		pmMetricRecorder := csrmetrics.OutboundRPCStartRecorder(r.MetricName)
+		response, err = pmClient.RenderParameterVersion(ctx, request, callOptions...)
+		if err != nil {
+			if e, ok := status.FromError(err); ok {
+				pmMetricRecorder(csrmetrics.OutboundRPCStatus(e.Code().String()))
+			} else {
+				// TODO: Keeping the same current implementation ->
+				// But should we keep the status as okay when we have encountered an error?
+				// In my opininon we should throw a default 500 error (rare case)
+				pmMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+			}
+			return err
 		}
-		return
+		pmMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	r.Cache.add(r.Identity, r.cacheKey(), response.RenderedPayload, response.GetParameterVersion())
+	return response.RenderedPayload, response.GetParameterVersion(), nil
+}
+
+// getParameterVersion returns the raw payload, with its secret references
+// unresolved, and name of the parameter version, from the PayloadCache if
+// possible.
+func (r *resourceFetcher) getParameterVersion(ctx context.Context, authOption *gax.CallOption, pmClient *parametermanager.Client) ([]byte, string, error) {
+	if payload, version, ok := r.Cache.get(r.Identity, r.cacheKey()); ok {
+		return payload, version, nil
 	}
-	if len(r.ExtractYAMLKey) > 0 { // ExtractYAMLKey populated
-		content, err := util.ExtractContentUsingYAMLKey(response.RenderedPayload, r.ExtractYAMLKey)
+	request := &parametermanagerpb.GetParameterVersionRequest{
+		Name: r.ResourceURI,
+		View: parametermanagerpb.View_FULL,
+	}
+	callOptions := []gax.CallOption{*authOption}
+	if r.Retry != nil {
+		callOptions = append(callOptions, infra.WithoutSDKRetries)
+	}
+	var response *parametermanagerpb.ParameterVersion
+	err := r.Retry.Do(ctx, "GetParameterVersion", func() error {
+		release, err := r.Limiter.Acquire(ctx, infra.APIParameterManager)
 		if err != nil {
-			resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
-			return
+			return err
 		}
-		resultChan <- &Resource{
-			ID:       r.ResourceURI,
-			FileName: r.FileName,
-			Path:     r.Path,
-			Version:  response.GetParameterVersion(),
-			Payload:  content,
-			Err:      nil,
+		defer release()
+		pmMetricRecorder := csrmetrics.OutboundRPCStartRecorder(r.MetricName)
+		response, err = pmClient.GetParameterVersion(ctx, request, callOptions...)
+		if err != nil {
+			pmMetricRecorder(csrmetrics.OutboundRPCStatus(status.Code(err).String()))
+			return err
 		}
-		return
+		pmMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
 	}
-	resultChan <- &Resource{
-		ID:       r.ResourceURI,
-		FileName: r.FileName,
-		Path:     r.Path,
-		Version:  response.GetParameterVersion(),
-		Payload:  response.RenderedPayload,
-		Err:      nil,
+	// RenderParameterVersion fails for disabled versions, the raw payload of
+	// a disabled version is not mounted either.
+	if response.GetDisabled() {
+		return nil, "", status.Error(codes.FailedPrecondition, fmt.Sprintf("%s is disabled", response.GetName()))
 	}
+	payload := response.GetPayload().GetData()
+	r.Cache.add(r.Identity, r.cacheKey(), payload, response.GetName())
+	return payload, response.GetName(), nil
 }
@@ -0,0 +1,188 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/util"
+)
+
+const payloadCacheMetricName = "payload"
+
+// PayloadCache is a node-local, in-memory cache of fetched resource payloads.
+//
+// Entries are keyed by the identity that fetched them together with the
+// resource name, so a payload is only ever served back to the same identity
+// that was authorized to read it from the API.
+//
+// Pinned secret versions (i.e. .../versions/7) are immutable and are kept for
+// pinnedTTL (forever if zero) while aliases such as 'latest' and rendered
+// parameter versions are only kept for aliasTTL. Once maxSize entries are
+// stored the least recently used entry is evicted.
+//
+// If maxStaleness is set, expired entries are retained until they are that
+// old so that they can be served by getStale when fetching fails.
+type PayloadCache struct {
+	maxSize      int
+	aliasTTL     time.Duration
+	pinnedTTL    time.Duration
+	maxStaleness time.Duration
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[payloadCacheKey]*list.Element
+
+	// now is replaced in unit tests.
+	now func() time.Time
+}
+
+type payloadCacheKey struct {
+	identity string
+	resource string
+}
+
+type payloadCacheEntry struct {
+	key       payloadCacheKey
+	payload   []byte
+	version   string
+	fetchedAt time.Time
+	expiresAt time.Time // zero if the entry does not expire
+}
+
+// NewPayloadCache returns a PayloadCache holding at most maxSize entries. A
+// maxSize of zero or less returns nil, which disables caching. A positive
+// maxStaleness enables getStale.
+func NewPayloadCache(maxSize int, aliasTTL, pinnedTTL, maxStaleness time.Duration) *PayloadCache {
+	if maxSize <= 0 {
+		return nil
+	}
+	return &PayloadCache{
+		maxSize:      maxSize,
+		aliasTTL:     aliasTTL,
+		pinnedTTL:    pinnedTTL,
+		maxStaleness: maxStaleness,
+		lru:          list.New(),
+		entries:      make(map[payloadCacheKey]*list.Element),
+		now:          time.Now,
+	}
+}
+
+// get returns the cached payload and version of resource for identity.
+func (c *PayloadCache) get(identity, resource string) ([]byte, string, bool) {
+	if c == nil {
+		return nil, "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[payloadCacheKey{identity, resource}]
+	if !ok {
+		csrmetrics.RecordCacheLookup(payloadCacheMetricName, csrmetrics.CacheMiss)
+		return nil, "", false
+	}
+	e := el.Value.(*payloadCacheEntry)
+	if !e.expiresAt.IsZero() && !c.now().Before(e.expiresAt) {
+		if !c.usableWhenStale(e) {
+			c.lru.Remove(el)
+			delete(c.entries, e.key)
+		}
+		csrmetrics.RecordCacheLookup(payloadCacheMetricName, csrmetrics.CacheMiss)
+		return nil, "", false
+	}
+	c.lru.MoveToFront(el)
+	csrmetrics.RecordCacheLookup(payloadCacheMetricName, csrmetrics.CacheHit)
+	return e.payload, e.version, true
+}
+
+// getStale returns the last payload and version of resource fetched by
+// identity, even if it expired, as long as it is not older than maxStaleness.
+// The age of the payload is returned as well.
+func (c *PayloadCache) getStale(identity, resource string) ([]byte, string, time.Duration, bool) {
+	if c == nil || c.maxStaleness <= 0 {
+		return nil, "", 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[payloadCacheKey{identity, resource}]
+	if !ok {
+		return nil, "", 0, false
+	}
+	e := el.Value.(*payloadCacheEntry)
+	if !c.usableWhenStale(e) {
+		c.lru.Remove(el)
+		delete(c.entries, e.key)
+		return nil, "", 0, false
+	}
+	c.lru.MoveToFront(el)
+	return e.payload, e.version, c.now().Sub(e.fetchedAt), true
+}
+
+func (c *PayloadCache) usableWhenStale(e *payloadCacheEntry) bool {
+	return c.maxStaleness > 0 && c.now().Sub(e.fetchedAt) < c.maxStaleness
+}
+
+// add stores the payload and version of resource fetched by identity.
+func (c *PayloadCache) add(identity, resource string, payload []byte, version string) {
+	if c == nil {
+		return
+	}
+	now := c.now()
+	ttl := c.aliasTTL
+	var expiresAt time.Time
+	if util.IsPinnedSecretVersion(resource) {
+		ttl = c.pinnedTTL
+	} else if ttl <= 0 {
+		// Aliases always need an expiry, otherwise rotation would never be
+		// observed. They are only kept to be served when stale.
+		if c.maxStaleness <= 0 {
+			return
+		}
+		expiresAt = now
+	}
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := payloadCacheKey{identity, resource}
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*payloadCacheEntry)
+		e.payload = payload
+		e.version = version
+		e.fetchedAt = now
+		e.expiresAt = expiresAt
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&payloadCacheEntry{
+		key:       key,
+		payload:   payload,
+		version:   version,
+		fetchedAt: now,
+		expiresAt: expiresAt,
+	})
+	for c.lru.Len() > c.maxSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*payloadCacheEntry).key)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+const (
+	pinnedSecretVersion = "projects/project/secrets/test/versions/7"
+	latestSecretVersion = "projects/project/secrets/test/versions/latest"
+)
+
+func TestPayloadCache(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := NewPayloadCache(10, time.Minute, 0, 0)
+	c.now = func() time.Time { return now }
+
+	c.add("identity-a", pinnedSecretVersion, []byte("pinned"), pinnedSecretVersion)
+	c.add("identity-a", latestSecretVersion, []byte("latest"), pinnedSecretVersion)
+
+	if got, _, ok := c.get("identity-a", pinnedSecretVersion); !ok || string(got) != "pinned" {
+		t.Errorf("get(identity-a, pinned) = %q, %v, want %q, true", got, ok, "pinned")
+	}
+	if got, version, ok := c.get("identity-a", latestSecretVersion); !ok || string(got) != "latest" || version != pinnedSecretVersion {
+		t.Errorf("get(identity-a, latest) = %q, %q, %v, want %q, %q, true", got, version, ok, "latest", pinnedSecretVersion)
+	}
+	if _, _, ok := c.get("identity-b", pinnedSecretVersion); ok {
+		t.Errorf("get(identity-b, pinned) = _, _, true, want payloads to not be shared across identities")
+	}
+
+	now = now.Add(time.Hour)
+	if _, _, ok := c.get("identity-a", latestSecretVersion); ok {
+		t.Errorf("get(identity-a, latest) after TTL = _, _, true, want expired")
+	}
+	if _, _, ok := c.get("identity-a", pinnedSecretVersion); !ok {
+		t.Errorf("get(identity-a, pinned) after TTL = _, _, false, want pinned versions to not expire")
+	}
+}
+
+func TestPayloadCacheEviction(t *testing.T) {
+	c := NewPayloadCache(2, time.Minute, time.Minute, 0)
+
+	c.add("identity", "projects/project/secrets/a/versions/1", []byte("a"), "")
+	c.add("identity", "projects/project/secrets/b/versions/1", []byte("b"), "")
+	// mark 'a' as recently used so that 'b' is evicted.
+	c.get("identity", "projects/project/secrets/a/versions/1")
+	c.add("identity", "projects/project/secrets/c/versions/1", []byte("c"), "")
+
+	if _, _, ok := c.get("identity", "projects/project/secrets/b/versions/1"); ok {
+		t.Errorf("get(b) = _, _, true, want least recently used entry to be evicted")
+	}
+	for _, name := range []string{"a", "c"} {
+		if _, _, ok := c.get("identity", "projects/project/secrets/"+name+"/versions/1"); !ok {
+			t.Errorf("get(%s) = _, _, false, want true", name)
+		}
+	}
+}
+
+func TestPayloadCacheDisabled(t *testing.T) {
+	c := NewPayloadCache(0, time.Minute, time.Minute, 0)
+	if c != nil {
+		t.Fatalf("NewPayloadCache(0, ...) = %v, want nil", c)
+	}
+	c.add("identity", pinnedSecretVersion, []byte("pinned"), pinnedSecretVersion)
+	if _, _, ok := c.get("identity", pinnedSecretVersion); ok {
+		t.Errorf("get() on nil cache = _, _, true, want false")
+	}
+}
+
+func TestPayloadCacheGetStale(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := NewPayloadCache(10, 0, 0, time.Hour)
+	c.now = func() time.Time { return now }
+
+	c.add("identity-a", latestSecretVersion, []byte("latest"), pinnedSecretVersion)
+
+	if _, _, ok := c.get("identity-a", latestSecretVersion); ok {
+		t.Errorf("get(identity-a, latest) = _, _, true, want aliases without TTL to only be served stale")
+	}
+	now = now.Add(30 * time.Minute)
+	got, version, age, ok := c.getStale("identity-a", latestSecretVersion)
+	if !ok || string(got) != "latest" || version != pinnedSecretVersion || age != 30*time.Minute {
+		t.Errorf("getStale(identity-a, latest) = %q, %q, %v, %v, want %q, %q, 30m, true", got, version, age, ok, "latest", pinnedSecretVersion)
+	}
+	if _, _, _, ok := c.getStale("identity-b", latestSecretVersion); ok {
+		t.Errorf("getStale(identity-b, latest) = _, _, _, true, want payloads to not be shared across identities")
+	}
+
+	now = now.Add(time.Hour)
+	if _, _, _, ok := c.getStale("identity-a", latestSecretVersion); ok {
+		t.Errorf("getStale(identity-a, latest) after max staleness = _, _, _, true, want false")
+	}
+}
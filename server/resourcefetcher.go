@@ -2,13 +2,26 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"slices"
+	"sort"
 	"sync"
 
+	kms "cloud.google.com/go/kms/apiv1"
 	parametermanager "cloud.google.com/go/parametermanager/apiv1"
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	privateca "cloud.google.com/go/security/privateca/apiv1"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/infra"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/util"
 	"github.com/googleapis/gax-go/v2"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
 )
 
 type ResourceType int
@@ -16,23 +29,66 @@ type ResourceType int
 const (
 	ParameterVersion ResourceType = iota
 	SecretRef
+	StorageObject
+	CAPool
 )
 
 // resourceFetcher is the interface for fetching external resources.
 type resourceFetcherInterface interface {
 	FetchSecrets(context.Context, *gax.CallOption, *secretmanager.Client, chan<- *Resource)
 	FetchParameterVersions(context.Context, *gax.CallOption, *parametermanager.Client, chan<- *Resource)
+	FetchStorageObjects(context.Context, *gax.CallOption, *StorageClient, chan<- *Resource)
+	IssueCertificates(context.Context, *gax.CallOption, *privateca.CertificateAuthorityClient, chan<- *Resource)
+	KMSDecrypt(context.Context, *gax.CallOption, *kms.KeyManagementClient, []byte) ([]byte, error)
 }
 
 type resourceFetcher struct {
-	TypeOfResource ResourceType
-	ResourceURI    string
-	FileName       string
-	Path           string
-	MetricName     string
-	Mode           *int32
-	ExtractJSONKey string
-	ExtractYAMLKey string
+	TypeOfResource  ResourceType
+	ResourceURI     string
+	FileName        string
+	Path            string
+	MetricName      string
+	Mode            *int32
+	ExtractJSONKey  string
+	ExtractYAMLKey  string
+	ExtractJSONPath string
+	ExtractYAMLPath string
+	ExtractAll      bool
+	Keys            []*config.SecretKey
+	Decode          string
+	Format          string
+	KeyFormat       string
+	// LatestEnabled resolves a secret version ending in /versions/latest to
+	// the newest ENABLED version. Resolved versions older than MinVersion
+	// fail the fetch.
+	LatestEnabled bool
+	MinVersion    int64
+	// Raw fetches the unrendered payload of a parameter version.
+	Raw bool
+	// KMSKey is the CryptoKey the payload is decrypted with, using
+	// KMSClient.
+	KMSKey    string
+	KMSClient *kms.KeyManagementClient
+	// TokenSource authenticates the requests which are not sent through a
+	// gRPC client, i.e. the downloads of Cloud Storage objects.
+	TokenSource oauth2.TokenSource
+	// InsecureEndpoints allows the tokens of TokenSource to be sent to
+	// endpoints without transport security.
+	InsecureEndpoints bool
+	// Certificate is the request of the certificates issued from the CA pool
+	// of ResourceURI. They are kept in Certificates for the pod with PodUID.
+	Certificate  *config.CertificateRequest
+	Certificates *CertificateStore
+	PodUID       string
+	// Identity identifies the credentials used for the mount and scopes the
+	// entries read from and written to Cache.
+	Identity string
+	Cache    *PayloadCache
+	// Fetches is shared by the fetchers of a mount so that each resource is
+	// fetched once.
+	Fetches *fetchGroup
+	Limiter *infra.Limiter
+	Retry   *infra.RetryPolicy
 }
 
 // Resource represents the Resource that is fetched.
@@ -42,23 +98,79 @@ type Resource struct {
 	Path     string
 	Version  string
 	Payload  []byte
+	// Files is set instead of Payload when the resource is fanned out into
+	// multiple files.
+	Files []*ResourceFile
+	// Stale is set if the payload was served from the PayloadCache because
+	// fetching it failed.
+	Stale bool
+	// Checksum is the CRC32C checksum of the payload as fetched, before any
+	// key extraction.
+	Checksum uint32
 	Err      error
 }
 
+// ResourceFile is one of the files written for a fanned out resource.
+type ResourceFile struct {
+	// Name is relative to the path of the resource.
+	Name    string
+	Mode    *int32
+	Payload []byte
+}
+
 func (r *resourceFetcher) Orchestrator(ctx context.Context, s *Server, authOption *gax.CallOption, resultChan chan<- *Resource, wg *sync.WaitGroup) {
 	defer wg.Done()
-	if util.IsSecretResource(r.ResourceURI) {
+	if len(r.KMSKey) > 0 {
+		if !util.IsCryptoKey(r.KMSKey) {
+			resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, fmt.Errorf("invalid kmsDecrypt key '%s', must be in the format projects/*/locations/*/keyRings/*/cryptoKeys/*", r.KMSKey))
+			return
+		}
+		if r.KMSClient == nil {
+			resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, fmt.Errorf("kmsDecrypt is not supported, no Cloud KMS client is configured"))
+			return
+		}
+	}
+	if r.Certificate != nil && !util.IsCAPool(r.ResourceURI) {
+		resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, fmt.Errorf("certificate is only supported for CA pools in the format projects/*/locations/*/caPools/*"))
+		return
+	}
+	// Checked first as object names may look like other resource names.
+	if util.IsStorageObject(r.ResourceURI) {
+		r.TypeOfResource = StorageObject
+		if s.StorageClient == nil {
+			resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, fmt.Errorf("Cloud Storage objects are not supported, no Cloud Storage client is configured"))
+			return
+		}
+		r.MetricName = "storage_get_object_requests"
+		r.FetchStorageObjects(ctx, authOption, s.StorageClient, resultChan)
+	} else if util.IsCAPool(r.ResourceURI) {
+		r.TypeOfResource = CAPool
+		if s.CAClient == nil {
+			resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, fmt.Errorf("certificate issuance is not supported, no Certificate Authority Service client is configured"))
+			return
+		}
+		if err := r.validateCertificateOptions(); err != nil {
+			resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+			return
+		}
+		r.MetricName = "privateca_create_certificate_requests"
+		r.IssueCertificates(ctx, authOption, s.CAClient, resultChan)
+	} else if util.IsSecretResource(r.ResourceURI) {
 		r.TypeOfResource = SecretRef
 		location, err := util.ExtractLocationFromSecretResource(r.ResourceURI)
 		if err != nil {
 			resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
 			return
 		}
-		var smClient *secretmanager.Client
-		if len(location) == 0 {
-			smClient = s.SecretClient
-		} else {
-			smClient = s.RegionalSecretClients[location]
+		smClient := s.SecretClient
+		if len(location) > 0 {
+			var release func()
+			smClient, release, err = s.RegionalSecretClients.Get(ctx, location)
+			if err != nil {
+				resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+				return
+			}
+			defer release()
 		}
 		r.MetricName = "secretmanager_access_secret_version_requests"
 		r.FetchSecrets(ctx, authOption, smClient, resultChan)
@@ -69,13 +181,20 @@ func (r *resourceFetcher) Orchestrator(ctx context.Context, s *Server, authOptio
 			resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
 			return
 		}
-		var pmClient *parametermanager.Client
-		if len(location) == 0 {
-			pmClient = s.ParameterManagerClient
-		} else {
-			pmClient = s.RegionalParameterManagerClients[location]
+		pmClient := s.ParameterManagerClient
+		if len(location) > 0 {
+			var release func()
+			pmClient, release, err = s.RegionalParameterManagerClients.Get(ctx, location)
+			if err != nil {
+				resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+				return
+			}
+			defer release()
 		}
 		r.MetricName = "parametermanager_render_parameter_version_requests"
+		if r.Raw {
+			r.MetricName = "parametermanager_get_parameter_version_requests"
+		}
 		r.FetchParameterVersions(ctx, authOption, pmClient, resultChan)
 	} else {
 		resultChan <- getErrorResource(
@@ -87,6 +206,276 @@ func (r *resourceFetcher) Orchestrator(ctx context.Context, s *Server, authOptio
 	}
 }
 
+// validateCertificateOptions rejects the options which do not apply to issued
+// certificates.
+func (r *resourceFetcher) validateCertificateOptions() error {
+	options := r.ExtractJSONKey + r.ExtractYAMLKey + r.ExtractJSONPath + r.ExtractYAMLPath + r.Decode + r.Format + r.KMSKey
+	if len(options) > 0 || r.ExtractAll || len(r.Keys) > 0 {
+		return fmt.Errorf("issued certificates cannot be combined with key extraction, decode, format or kmsDecrypt")
+	}
+	return nil
+}
+
+// buildResource applies the key extraction, decoding, decryption and format
+// configured for the resource to the fetched payload.
+func (r *resourceFetcher) buildResource(ctx context.Context, authOption *gax.CallOption, payload []byte, version string) *Resource {
+	// Both simultaneously can't be populated.
+	if len(r.ExtractJSONKey) > 0 && len(r.ExtractYAMLKey) > 0 {
+		return getErrorResource(
+			r.ResourceURI,
+			r.FileName,
+			r.Path,
+			fmt.Errorf("both ExtractJSONKey and ExtractYAMLKey can't be simultaneously non empty strings"),
+		)
+	}
+	extractions := 0
+	for _, e := range []string{r.ExtractJSONKey, r.ExtractYAMLKey, r.ExtractJSONPath, r.ExtractYAMLPath} {
+		if len(e) > 0 {
+			extractions++
+		}
+	}
+	if r.ExtractAll {
+		extractions++
+	}
+	if len(r.Keys) > 0 {
+		extractions++
+	}
+	if extractions > 1 {
+		return getErrorResource(
+			r.ResourceURI,
+			r.FileName,
+			r.Path,
+			fmt.Errorf("only one of ExtractJSONKey, ExtractYAMLKey, ExtractJSONPath, ExtractYAMLPath, ExtractAll and Keys can be set"),
+		)
+	}
+	content := payload
+	if len(r.ExtractJSONKey) > 0 { // ExtractJSONKey populated
+		var err error
+		content, err = util.ExtractContentUsingJSONKey(payload, r.ExtractJSONKey)
+		if err != nil {
+			return getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+		}
+	}
+	if len(r.ExtractYAMLKey) > 0 { // ExtractYAMLKey populated
+		var err error
+		content, err = util.ExtractContentUsingYAMLKey(payload, r.ExtractYAMLKey)
+		if err != nil {
+			return getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+		}
+	}
+	if len(r.ExtractJSONPath) > 0 {
+		var err error
+		content, err = util.ExtractContentUsingJSONPath(payload, r.ExtractJSONPath)
+		if err != nil {
+			return getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+		}
+	}
+	if len(r.ExtractYAMLPath) > 0 {
+		var err error
+		content, err = util.ExtractContentUsingYAMLPath(payload, r.ExtractYAMLPath)
+		if err != nil {
+			return getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+		}
+	}
+	var files []*ResourceFile
+	if r.ExtractAll || len(r.Keys) > 0 {
+		var err error
+		files, err = r.buildFiles(payload)
+		if err != nil {
+			return getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+		}
+		content = nil
+	}
+	if len(r.Decode) > 0 {
+		var err error
+		if content, err = r.decode(content); err != nil {
+			return getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+		}
+		for _, f := range files {
+			if f.Payload, err = r.decode(f.Payload); err != nil {
+				return getErrorResource(r.ResourceURI, r.FileName, r.Path, fmt.Errorf("file '%s': %w", f.Name, err))
+			}
+		}
+	}
+	if len(r.KMSKey) > 0 {
+		var err error
+		if content, err = r.decrypt(ctx, authOption, content); err != nil {
+			return getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+		}
+		for _, f := range files {
+			if f.Payload, err = r.decrypt(ctx, authOption, f.Payload); err != nil {
+				return getErrorResource(r.ResourceURI, r.FileName, r.Path, fmt.Errorf("file '%s': %w", f.Name, err))
+			}
+		}
+	}
+	if len(r.Format) > 0 {
+		var err error
+		if content, files, err = r.format(content, files); err != nil {
+			return getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+		}
+	}
+	return &Resource{
+		ID:       r.ResourceURI,
+		FileName: r.FileName,
+		Path:     r.Path,
+		Version:  version,
+		Payload:  content,
+		Files:    files,
+		Checksum: crc32.Checksum(payload, crc32cTable),
+		Err:      nil,
+	}
+}
+
+// decode applies the decode option of the resource to content.
+func (r *resourceFetcher) decode(content []byte) ([]byte, error) {
+	if content == nil {
+		return nil, nil
+	}
+	return util.Decode(content, r.Decode)
+}
+
+// format applies the format option of the resource to the extracted content
+// or files.
+func (r *resourceFetcher) format(content []byte, files []*ResourceFile) ([]byte, []*ResourceFile, error) {
+	switch r.Format {
+	case util.FormatDotenv:
+		content, err := r.formatDotenv(content, files)
+		return content, nil, err
+	case util.FormatPEM:
+		if files != nil {
+			return nil, nil, fmt.Errorf("format %s cannot be combined with ExtractAll or Keys", util.FormatPEM)
+		}
+		files, err := r.formatPEM(content)
+		return nil, files, err
+	default:
+		return nil, nil, fmt.Errorf("unsupported format value '%s', must be one of %s or %s", r.Format, util.FormatDotenv, util.FormatPEM)
+	}
+}
+
+// formatDotenv renders the extracted files, or all top-level keys of content
+// if the resource is not fanned out, into a single env file.
+func (r *resourceFetcher) formatDotenv(content []byte, files []*ResourceFile) ([]byte, error) {
+	if files == nil {
+		var err error
+		if files, err = allKeyFiles(content); err != nil {
+			return nil, err
+		}
+	}
+	vars := make([]util.EnvVar, 0, len(files))
+	for _, f := range files {
+		vars = append(vars, util.EnvVar{Name: f.Name, Value: f.Payload})
+	}
+	return util.RenderDotenv(vars)
+}
+
+// formatPEM splits a PEM bundle into the tls.crt, tls.key and, if the bundle
+// includes a root certificate, ca.crt files.
+func (r *resourceFetcher) formatPEM(content []byte) ([]*ResourceFile, error) {
+	bundle, err := util.SplitPEMBundle(content, r.KeyFormat)
+	if err != nil {
+		return nil, err
+	}
+	files := []*ResourceFile{
+		{Name: "tls.crt", Payload: bundle.Certificate},
+		{Name: "tls.key", Payload: bundle.PrivateKey},
+	}
+	if bundle.CA != nil {
+		files = append(files, &ResourceFile{Name: "ca.crt", Payload: bundle.CA})
+	}
+	return files, nil
+}
+
+// buildFiles fans the payload out into one file per extracted key.
+func (r *resourceFetcher) buildFiles(payload []byte) ([]*ResourceFile, error) {
+	var files []*ResourceFile
+	if r.ExtractAll {
+		var err error
+		if files, err = allKeyFiles(payload); err != nil {
+			return nil, err
+		}
+	} else {
+		paths := make([]string, 0, len(r.Keys))
+		for _, k := range r.Keys {
+			paths = append(paths, k.Key)
+		}
+		values, err := util.ExtractPaths(payload, paths)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range r.Keys {
+			name := k.FileName
+			if name == "" {
+				name = k.Key
+			}
+			files = append(files, &ResourceFile{Name: name, Mode: k.Mode, Payload: values[k.Key]})
+		}
+	}
+
+	names := make(map[string]bool, len(files))
+	for _, f := range files {
+		if !util.IsValidFileName(f.Name) {
+			return nil, fmt.Errorf("invalid file name '%s' for extracted key, set a fileName consisting of alphanumeric characters, '-', '_' or '.'", f.Name)
+		}
+		if names[f.Name] {
+			return nil, fmt.Errorf("duplicate file name '%s' for extracted keys", f.Name)
+		}
+		names[f.Name] = true
+	}
+	return files, nil
+}
+
+// allKeyFiles returns one file per top-level key of the payload, sorted by
+// name.
+func allKeyFiles(payload []byte) ([]*ResourceFile, error) {
+	values, err := util.ExtractAllKeys(payload)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*ResourceFile, 0, len(values))
+	for key, value := range values {
+		files = append(files, &ResourceFile{Name: key, Payload: value})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// staleErrorCodes are the status codes of transient fetch failures which may be
+// answered with a stale payload. Errors such as PermissionDenied or NotFound
+// are never answered from the cache, so that revoked access and deleted
+// versions take effect, and neither are Internal errors which may be
+// permanent.
+var staleErrorCodes = []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted}
+
+// staleFallback returns the last payload fetched by the identity of the mount
+// if err is transient and the payload is within the maximum staleness of the
+// PayloadCache. Otherwise err is returned.
+func (r *resourceFetcher) staleFallback(api infra.API, err error) (*fetchedPayload, error) {
+	if !slices.Contains(staleErrorCodes, status.Code(err)) && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, err
+	}
+	payload, version, age, ok := r.Cache.getStale(r.Identity, r.cacheKey())
+	if !ok {
+		return nil, err
+	}
+	klog.InfoS("serving stale payload after fetch failure", "resource_name", r.ResourceURI, "version", version, "age", age.String(), "err", err.Error())
+	csrmetrics.RecordStalePayload(string(api))
+	return &fetchedPayload{data: payload, version: version, stale: true}, nil
+}
+
+// cacheKey is the key of the payload of the resource in the PayloadCache and
+// the fetchGroup. Raw parameter versions are kept apart from rendered ones and
+// latestEnabled secrets from the latest version.
+func (r *resourceFetcher) cacheKey() string {
+	switch {
+	case r.Raw:
+		return r.ResourceURI + "#raw"
+	case r.LatestEnabled:
+		return r.ResourceURI + "#latestEnabled"
+	default:
+		return r.ResourceURI
+	}
+}
+
 func getErrorResource(resourceURI, fileName, path string, err error) *Resource {
 	return &Resource{
 		ID:       resourceURI,
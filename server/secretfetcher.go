@@ -3,83 +3,192 @@ package server
 import (
 	"context"
 	"fmt"
+	"hash/crc32"
+	"path"
+	"strconv"
+	"strings"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
-	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/util"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/infra"
 	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// crc32cTable is the Castagnoli table Secret Manager uses for data_crc32c.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
 func (r *resourceFetcher) FetchSecrets(ctx context.Context, authOption *gax.CallOption, smClient *secretmanager.Client, resultChan chan<- *Resource) {
-	smMetricRecorder := csrmetrics.OutboundRPCStartRecorder(r.MetricName)
-	request := &secretmanagerpb.AccessSecretVersionRequest{
-		Name: r.ResourceURI,
+	fetched, err := r.Fetches.do(r.cacheKey(), func() (*fetchedPayload, error) {
+		name := r.ResourceURI
+		if r.LatestEnabled {
+			var err error
+			if name, err = r.latestEnabledVersion(ctx, authOption, smClient); err != nil {
+				return r.staleFallback(infra.APISecretManager, err)
+			}
+		}
+		payload, version, err := r.accessSecretVersion(ctx, authOption, smClient, name)
+		if err != nil {
+			return r.staleFallback(infra.APISecretManager, err)
+		}
+		if name != r.ResourceURI {
+			// The resolved version is cached under its own name, the payload
+			// is also kept under the key staleFallback looks up.
+			r.Cache.add(r.Identity, r.cacheKey(), payload, version)
+		}
+		return &fetchedPayload{data: payload, version: version}, nil
+	})
+	if err == nil {
+		err = r.checkMinVersion(fetched.version)
 	}
-	response, err := smClient.AccessSecretVersion(ctx, request, *authOption)
-
 	if err != nil {
-		if e, ok := status.FromError(err); ok {
-			smMetricRecorder(csrmetrics.OutboundRPCStatus(e.Code().String()))
-		} else {
-			// TODO: Keeping the same current implementation ->
-			// But should we keep the status as okay when we have encountered an error?
-			// In my opininon we should throw a default 500 error (rare case)
-			smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
-		}
 		resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
 		return
 	}
-	smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
-	// Both simultaneously can't be populated.
-	if len(r.ExtractJSONKey) > 0 && len(r.ExtractYAMLKey) > 0 {
-		resultChan <- getErrorResource(
-			r.ResourceURI,
-			r.FileName,
-			r.Path,
-			fmt.Errorf(r.ResourceURI, "both ExtractJSONKey and ExtractYAMLKey can't be simultaneously non empty strings"),
-		)
-		return
+	resource := r.buildResource(ctx, authOption, fetched.data, fetched.version)
+	resource.Stale = fetched.stale
+	resultChan <- resource
+}
+
+// latestEnabledVersion returns the name of the newest ENABLED version of the
+// secret of the resource.
+func (r *resourceFetcher) latestEnabledVersion(ctx context.Context, authOption *gax.CallOption, smClient *secretmanager.Client) (string, error) {
+	request := &secretmanagerpb.ListSecretVersionsRequest{
+		Parent: strings.TrimSuffix(r.ResourceURI, "/versions/latest"),
+		Filter: "state:ENABLED",
 	}
-	if len(r.ExtractJSONKey) > 0 { // ExtractJSONKey populated
-		content, err := util.ExtractContentUsingJSONKey(response.Payload.Data, r.ExtractJSONKey)
+	callOptions := []gax.CallOption{*authOption}
+	if r.Retry != nil {
+		callOptions = append(callOptions, infra.WithoutSDKRetries)
+	}
+	var name string
+	err := r.Retry.Do(ctx, "ListSecretVersions", func() error {
+		release, err := r.Limiter.Acquire(ctx, infra.APISecretManager)
 		if err != nil {
-			resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
-			return
+			return err
 		}
-		resultChan <- &Resource{
-			ID:       r.ResourceURI,
-			FileName: r.FileName,
-			Path:     r.Path,
-			Version:  response.GetName(),
-			Payload:  content,
-			Err:      nil,
+		defer release()
+		smMetricRecorder := csrmetrics.OutboundRPCStartRecorder("secretmanager_list_secret_versions_requests")
+		name, err = newestEnabledVersion(smClient.ListSecretVersions(ctx, request, callOptions...))
+		if err != nil {
+			smMetricRecorder(csrmetrics.OutboundRPCStatus(status.Code(err).String()))
+			return err
 		}
-		return
+		smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", status.Error(codes.NotFound, fmt.Sprintf("no enabled version of %s", request.Parent))
 	}
-	if len(r.ExtractYAMLKey) > 0 { // ExtractYAMLKey populated
-		content, err := util.ExtractContentUsingYAMLKey(response.Payload.Data, r.ExtractYAMLKey)
+	return name, nil
+}
+
+// newestEnabledVersion returns the name of the ENABLED version with the highest
+// version ID listed by it, or "" if there is none. Versions are listed newest
+// first, so the first page usually holds it, but all pages are checked so that
+// the order is not relied upon.
+func newestEnabledVersion(it *secretmanager.SecretVersionIterator) (string, error) {
+	var newest string
+	var newestID int64
+	for {
+		version, err := it.Next()
+		if err == iterator.Done {
+			return newest, nil
+		}
 		if err != nil {
-			resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
-			return
+			return "", err
 		}
-		resultChan <- &Resource{
-			ID:       r.ResourceURI,
-			FileName: r.FileName,
-			Path:     r.Path,
-			Version:  response.GetName(),
-			Payload:  content,
-			Err:      nil,
+		if version.GetState() != secretmanagerpb.SecretVersion_ENABLED {
+			continue
 		}
-		return
+		id, err := strconv.ParseInt(path.Base(version.GetName()), 10, 64)
+		if err == nil && id > newestID {
+			newest, newestID = version.GetName(), id
+		}
+	}
+}
+
+// checkMinVersion fails if the version the resource resolved to is older
+// than MinVersion.
+func (r *resourceFetcher) checkMinVersion(version string) error {
+	if r.MinVersion <= 0 {
+		return nil
+	}
+	id, err := strconv.ParseInt(path.Base(version), 10, 64)
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("unable to check minVersion %d, %s is not a numeric version", r.MinVersion, version))
+	}
+	if id < r.MinVersion {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("resolved version %s is older than minVersion %d", version, r.MinVersion))
+	}
+	return nil
+}
+
+// accessSecretVersion returns the payload and version name of the secret
+// version name, from the PayloadCache if possible.
+func (r *resourceFetcher) accessSecretVersion(ctx context.Context, authOption *gax.CallOption, smClient *secretmanager.Client, name string) ([]byte, string, error) {
+	if payload, version, ok := r.Cache.get(r.Identity, name); ok {
+		return payload, version, nil
+	}
+	request := &secretmanagerpb.AccessSecretVersionRequest{
+		Name: name,
+	}
+	callOptions := []gax.CallOption{*authOption}
+	if r.Retry != nil {
+		callOptions = append(callOptions, infra.WithoutSDKRetries)
+	}
+	var response *secretmanagerpb.AccessSecretVersionResponse
+	err := r.Retry.Do(ctx, "AccessSecretVersion", func() error {
+		release, err := r.Limiter.Acquire(ctx, infra.APISecretManager)
+		if err != nil {
+			return err
+		}
+		defer release()
+		smMetricRecorder := csrmetrics.OutboundRPCStartRecorder(r.MetricName)
+		response, err = smClient.AccessSecretVersion(ctx, request, callOptions...)
+
+		if err != nil {
+			if e, ok := status.FromError(err); ok {
+				smMetricRecorder(csrmetrics.OutboundRPCStatus(e.Code().String()))
+			} else {
+				// TODO: Keeping the same current implementation ->
+				// But should we keep the status as okay when we have encountered an error?
+				// In my opininon we should throw a default 500 error (rare case)
+				smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+			}
+			return err
+		}
+		smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if err := verifyPayloadChecksum(response.GetPayload()); err != nil {
+		return nil, "", err
+	}
+	r.Cache.add(r.Identity, name, response.Payload.Data, response.GetName())
+	return response.Payload.Data, response.GetName(), nil
+}
+
+// verifyPayloadChecksum compares the CRC32C checksum of the payload data with
+// the data_crc32c reported by Secret Manager, if any.
+func verifyPayloadChecksum(payload *secretmanagerpb.SecretPayload) error {
+	if payload.DataCrc32C == nil {
+		csrmetrics.RecordPayloadChecksum(csrmetrics.ChecksumMissing)
+		return nil
 	}
-	resultChan <- &Resource{
-		ID:       r.ResourceURI,
-		FileName: r.FileName,
-		Path:     r.Path,
-		Version:  response.GetName(),
-		Payload:  response.Payload.Data,
-		Err:      nil,
+	got := int64(crc32.Checksum(payload.GetData(), crc32cTable))
+	if got != payload.GetDataCrc32C() {
+		csrmetrics.RecordPayloadChecksum(csrmetrics.ChecksumMismatch)
+		return status.Error(codes.DataLoss, fmt.Sprintf("payload checksum mismatch: got crc32c %d, want %d", got, payload.GetDataCrc32C()))
 	}
+	csrmetrics.RecordPayloadChecksum(csrmetrics.ChecksumMatch)
+	return nil
 }
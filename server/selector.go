@@ -0,0 +1,184 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/infra"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// expandSelectors returns a copy of cfg in which every selector entry is
+// replaced by one entry per matching secret. The selectors of the mount may
+// match at most MaxSelectedSecrets secrets in total.
+func expandSelectors(ctx context.Context, s *Server, authOption *gax.CallOption, cfg *config.MountConfig) (*config.MountConfig, error) {
+	if !slices.ContainsFunc(cfg.Secrets, func(secret *config.Secret) bool { return secret.Selector != nil }) {
+		return cfg, nil
+	}
+	expanded := *cfg
+	expanded.Secrets = make([]*config.Secret, 0, len(cfg.Secrets))
+	selected := 0
+	for _, secret := range cfg.Secrets {
+		if secret.Selector == nil {
+			expanded.Secrets = append(expanded.Secrets, secret)
+			continue
+		}
+		names, err := s.listSelectedSecrets(ctx, authOption, secret.Selector, selected)
+		if err != nil {
+			return nil, status.Error(status.Code(err), fmt.Sprintf("failed to list secrets for the selector of %q: %v", secret.PathString(), err))
+		}
+		selected += len(names)
+		version := secret.Selector.Version
+		if version == "" {
+			version = "latest"
+		}
+		for _, name := range names {
+			match := *secret
+			match.Selector = nil
+			match.ResourceName = fmt.Sprintf("%s/versions/%s", name, version)
+			match.FileName = ""
+			match.Path = path.Join(secret.PathString(), path.Base(name))
+			expanded.Secrets = append(expanded.Secrets, &match)
+		}
+	}
+	return &expanded, nil
+}
+
+// listSelectedSecrets returns the sorted names of the secrets matching the
+// selector, given that the other selectors of the mount already matched
+// selected secrets. Matching more than MaxSelectedSecrets in total is an
+// error.
+func (s *Server) listSelectedSecrets(ctx context.Context, authOption *gax.CallOption, selector *config.SecretSelector, selected int) ([]string, error) {
+	parent := fmt.Sprintf("projects/%s", selector.Project)
+	smClient := s.SecretClient
+	if selector.Location != "" {
+		parent = fmt.Sprintf("projects/%s/locations/%s", selector.Project, selector.Location)
+		var release func()
+		var err error
+		if smClient, release, err = s.RegionalSecretClients.Get(ctx, selector.Location); err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	request := &secretmanagerpb.ListSecretsRequest{
+		Parent: parent,
+		Filter: selectorFilter(selector),
+	}
+	callOptions := []gax.CallOption{*authOption}
+	if s.RetryPolicy != nil {
+		callOptions = append(callOptions, infra.WithoutSDKRetries)
+	}
+
+	// Failed listings are restarted from the first page.
+	var names []string
+	err := s.RetryPolicy.Do(ctx, "ListSecrets", func() error {
+		release, err := s.Limiter.Acquire(ctx, infra.APISecretManager)
+		if err != nil {
+			return err
+		}
+		defer release()
+		smMetricRecorder := csrmetrics.OutboundRPCStartRecorder("secretmanager_list_secrets_requests")
+		names, err = s.listMatchingSecrets(ctx, smClient, request, callOptions, selector, selected)
+		if err != nil {
+			smMetricRecorder(csrmetrics.OutboundRPCStatus(status.Code(err).String()))
+			return err
+		}
+		smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.MaxSelectedSecrets > 0 && selected+len(names) > s.MaxSelectedSecrets {
+		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("selectors of the mount match more than %d secrets", s.MaxSelectedSecrets))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// listMatchingSecrets pages through the secrets listed for request and
+// returns the names of those matching the selector, stopping once more than
+// MaxSelectedSecrets are selected in total.
+func (s *Server) listMatchingSecrets(ctx context.Context, smClient *secretmanager.Client, request *secretmanagerpb.ListSecretsRequest, callOptions []gax.CallOption, selector *config.SecretSelector, selected int) ([]string, error) {
+	var names []string
+	it := smClient.ListSecrets(ctx, request, callOptions...)
+	for {
+		secret, err := it.Next()
+		if err == iterator.Done {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The filter only narrows the listing, the selector is matched
+		// exactly here.
+		if !selectorMatches(selector, secret) {
+			continue
+		}
+		names = append(names, secret.GetName())
+		if s.MaxSelectedSecrets > 0 && selected+len(names) > s.MaxSelectedSecrets {
+			return names, nil
+		}
+	}
+}
+
+// selectorFilter builds the ListSecrets filter of the selector.
+func selectorFilter(selector *config.SecretSelector) string {
+	var terms []string
+	if selector.NamePrefix != "" {
+		terms = append(terms, fmt.Sprintf("name:%s", selector.NamePrefix))
+	}
+	keys := make([]string, 0, len(selector.LabelSelector))
+	for k := range selector.LabelSelector {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := selector.LabelSelector[k]
+		if v == "" {
+			v = "*"
+		}
+		terms = append(terms, fmt.Sprintf("labels.%s:%s", k, v))
+	}
+	return strings.Join(terms, " AND ")
+}
+
+// selectorMatches returns true if the ID and labels of secret match the
+// selector.
+func selectorMatches(selector *config.SecretSelector, secret *secretmanagerpb.Secret) bool {
+	if !strings.HasPrefix(path.Base(secret.GetName()), selector.NamePrefix) {
+		return false
+	}
+	for k, v := range selector.LabelSelector {
+		got, ok := secret.GetLabels()[k]
+		if !ok || (v != "" && got != v) {
+			return false
+		}
+	}
+	return true
+}
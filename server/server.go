@@ -17,20 +17,31 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math"
 	"os"
+	"path"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/auth"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/infra"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/util"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/vars"
 	"github.com/googleapis/gax-go/v2"
+	"golang.org/x/oauth2"
 
+	kms "cloud.google.com/go/kms/apiv1"
 	parametermanager "cloud.google.com/go/parametermanager/apiv1"
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	privateca "cloud.google.com/go/security/privateca/apiv1"
 	"google.golang.org/api/option"
 	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
@@ -39,6 +50,8 @@ import (
 	"google.golang.org/grpc/credentials/oauth"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/anypb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 )
@@ -48,9 +61,81 @@ type Server struct {
 	AuthClient                      *auth.Client
 	SecretClient                    *secretmanager.Client
 	ParameterManagerClient          *parametermanager.Client
-	RegionalSecretClients           map[string]*secretmanager.Client
-	RegionalParameterManagerClients map[string]*parametermanager.Client
-	ServerClientOptions             []option.ClientOption
+	RegionalSecretClients           *ClientRegistry[*secretmanager.Client]
+	RegionalParameterManagerClients *ClientRegistry[*parametermanager.Client]
+	// ServerClientOptions are the options of the regional clients created
+	// when RegionalSecretClients or RegionalParameterManagerClients is nil.
+	//
+	// Deprecated: set RegionalSecretClients and
+	// RegionalParameterManagerClients instead.
+	ServerClientOptions []option.ClientOption
+	regionalClientsOnce sync.Once
+	// KMSClient decrypts the payloads of secrets with the kmsDecrypt option.
+	KMSClient *kms.KeyManagementClient
+	// StorageClient downloads the Cloud Storage objects referenced by
+	// gs:// or projects/_/buckets/*/objects/* resource names. A nil
+	// StorageClient rejects them.
+	StorageClient *StorageClient
+	// CAClient issues the certificates of entries whose resourceName is a
+	// Certificate Authority Service CA pool, which are kept in Certificates
+	// until they are due for renewal. A nil Certificates re-issues them on
+	// every mount.
+	CAClient     *privateca.CertificateAuthorityClient
+	Certificates *CertificateStore
+	// Keystores keeps the rendered pkcs12 and jks keystores, so that their
+	// bytes only change with their inputs. A nil Keystores renders them on
+	// every mount.
+	Keystores *KeystoreCache
+	// MaxSelectedSecrets is the number of secrets the selector entries of a
+	// mount may expand to in total, beyond which the mount fails. Zero does
+	// not limit selectors.
+	MaxSelectedSecrets int
+	// InsecureEndpoints allows the per-RPC credentials to be sent to
+	// endpoints without transport security, i.e. local emulators.
+	InsecureEndpoints bool
+	// PayloadCache caches fetched payloads across mounts. A nil cache
+	// disables caching.
+	PayloadCache *PayloadCache
+	// ExposePayloadChecksums appends the CRC32C checksum of every fetched
+	// payload to the version of its ObjectVersion, e.g.
+	// "projects/p/secrets/s/versions/2#crc32c:1234".
+	ExposePayloadChecksums bool
+	// Limiter bounds the concurrency and rate of the Secret Manager and
+	// Parameter Manager calls across mounts. A nil Limiter does not limit
+	// calls.
+	Limiter *infra.Limiter
+	// RetryPolicy retries the Secret Manager and Parameter Manager calls
+	// failing with transient errors. A nil RetryPolicy leaves retries to the
+	// client libraries.
+	RetryPolicy *infra.RetryPolicy
+	// EventRecorder emits the Kubernetes events of the pods being mounted. A
+	// nil EventRecorder disables events.
+	EventRecorder record.EventRecorder
+}
+
+// initRegionalClients creates the regional client registries which are not
+// set, using the ServerClientOptions.
+func (s *Server) initRegionalClients() {
+	s.regionalClientsOnce.Do(func() {
+		if s.RegionalSecretClients == nil {
+			s.RegionalSecretClients = NewClientRegistry(func(ctx context.Context, location string) (*secretmanager.Client, error) {
+				endpoint, err := vars.SecretManagerRegionalEndpoint.GetUniverseValue()
+				if err != nil {
+					return nil, err
+				}
+				return util.GetRegionalSecretManagerClient(ctx, location, endpoint, s.ServerClientOptions)
+			}, 0)
+		}
+		if s.RegionalParameterManagerClients == nil {
+			s.RegionalParameterManagerClients = NewClientRegistry(func(ctx context.Context, location string) (*parametermanager.Client, error) {
+				endpoint, err := vars.ParameterManagerRegionalEndpoint.GetUniverseValue()
+				if err != nil {
+					return nil, err
+				}
+				return util.GetRegionalParameterManagerClient(ctx, location, endpoint, s.ServerClientOptions)
+			}, 0)
+		}
+	})
 }
 
 // Keeping it separate as same resource name can be used to
@@ -93,13 +178,65 @@ func (s *Server) Mount(ctx context.Context, req *v1alpha1.MountRequest) (*v1alph
 	// Build a grpc credentials.PerRPCCredentials using
 	// the grpc google.golang.org/grpc/credentials/oauth package, not to be
 	// confused with the oauth2.TokenSource that it wraps.
-	gts := oauth.TokenSource{TokenSource: ts}
+	var gts credentials.PerRPCCredentials = oauth.TokenSource{TokenSource: ts}
+	if s.InsecureEndpoints {
+		gts = insecureCredentials{gts}
+	}
 
 	// Fetch the secrets from the secretmanager API based on the
 	// SecretProviderClass configuration.
 	return handleMountEvent(ctx, gts, cfg, s)
 }
 
+// Close closes the API clients of the server.
+func (s *Server) Close() error {
+	var errs []error
+	if s.SecretClient != nil {
+		errs = append(errs, s.SecretClient.Close())
+	}
+	if s.ParameterManagerClient != nil {
+		errs = append(errs, s.ParameterManagerClient.Close())
+	}
+	if s.KMSClient != nil {
+		errs = append(errs, s.KMSClient.Close())
+	}
+	if s.CAClient != nil {
+		errs = append(errs, s.CAClient.Close())
+	}
+	if s.RegionalSecretClients != nil {
+		errs = append(errs, s.RegionalSecretClients.Close())
+	}
+	if s.RegionalParameterManagerClients != nil {
+		errs = append(errs, s.RegionalParameterManagerClients.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// insecureCredentials wraps per-RPC credentials so that they are also sent
+// over connections without transport security.
+type insecureCredentials struct {
+	credentials.PerRPCCredentials
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (insecureCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// mountTokenSource returns the oauth2.TokenSource behind the per-RPC
+// credentials of a mount. The credentials themselves cannot authenticate plain
+// HTTP requests as they require the information of a gRPC call. Nil is
+// returned for other credentials.
+func mountTokenSource(creds credentials.PerRPCCredentials) oauth2.TokenSource {
+	if c, ok := creds.(insecureCredentials); ok {
+		creds = c.PerRPCCredentials
+	}
+	if c, ok := creds.(oauth.TokenSource); ok {
+		return c.TokenSource
+	}
+	return nil
+}
+
 // Version implements provider csi-provider method
 func (s *Server) Version(ctx context.Context, req *v1alpha1.VersionRequest) (*v1alpha1.VersionResponse, error) {
 	return &v1alpha1.VersionResponse{
@@ -113,35 +250,42 @@ func (s *Server) Version(ctx context.Context, req *v1alpha1.VersionRequest) (*v1
 // include them in the MountResponse based on the SecretProviderClass
 // configuration.
 func handleMountEvent(ctx context.Context, creds credentials.PerRPCCredentials, cfg *config.MountConfig, s *Server) (*v1alpha1.MountResponse, error) {
+	s.initRegionalClients()
+
 	// need to build a per-rpc call option based of the tokensource
 	callAuth := gax.WithGRPCOptions(grpc.PerRPCCredentials(creds))
 
-	// Storing it as a resultMap to have 1 API call for each resource instead
-	// of de-duplicating API calls for duplicate resources
+	// Selector entries are replaced by the secrets they match.
+	cfg, err := expandSelectors(ctx, s, &callAuth, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := callerIdentity(cfg)
+	fetches := newFetchGroup()
+
+	// Results are stored per file, while the fetches group collapses the API
+	// calls for resources which are mounted to several files.
 	resultMap := make(map[resourceIdentity]*Resource)
 
 	for _, secret := range cfg.Secrets {
+		if secret.IsComposite() {
+			// rendered once the other entries are fetched
+			continue
+		}
+		if util.IsStorageObject(secret.ResourceName) {
+			// object names may look like other resource names
+			continue
+		}
 		if util.IsSecretResource(secret.ResourceName) {
-			location, err := util.ExtractLocationFromSecretResource(secret.ResourceName)
-			if err != nil {
+			if _, err := util.ExtractLocationFromSecretResource(secret.ResourceName); err != nil {
 				resultMap[resourceIdentity{secret.ResourceName, secret.FileName, secret.Path}] = getErrorResource(secret.ResourceName, secret.FileName, secret.Path, err)
-				continue
-			}
-			_, ok := s.RegionalSecretClients[location]
-			if !ok {
-				s.RegionalSecretClients[location] = util.GetRegionalSecretManagerClient(ctx, location, s.ServerClientOptions)
 			}
 		} else if util.IsParameterManagerResource(secret.ResourceName) {
-			location, err := util.ExtractLocationFromParameterManagerResource(secret.ResourceName)
-			if err != nil {
+			if _, err := util.ExtractLocationFromParameterManagerResource(secret.ResourceName); err != nil {
 				resultMap[resourceIdentity{secret.ResourceName, secret.FileName, secret.Path}] = getErrorResource(secret.ResourceName, secret.FileName, secret.Path, err)
-				continue
-			}
-			_, ok := s.RegionalParameterManagerClients[location]
-			if !ok {
-				s.RegionalParameterManagerClients[location] = util.GetRegionalParameterManagerClient(ctx, location, s.ServerClientOptions)
 			}
-		} else {
+		} else if !util.IsCAPool(secret.ResourceName) {
 			resultMap[resourceIdentity{secret.ResourceName, secret.FileName, secret.Path}] = getErrorResource(secret.ResourceName, secret.FileName, secret.Path, fmt.Errorf("unknown resource type"))
 		}
 	}
@@ -149,17 +293,42 @@ func handleMountEvent(ctx context.Context, creds credentials.PerRPCCredentials,
 	wg := sync.WaitGroup{}
 	outputChannel := make(chan *Resource, len(cfg.Secrets))
 	for _, secret := range cfg.Secrets {
+		if secret.IsComposite() {
+			continue
+		}
 		if val, ok := resultMap[resourceIdentity{secret.ResourceName, secret.FileName, secret.Path}]; ok && val.Err != nil {
 			klog.ErrorS(val.Err, "error for resourceName: ", secret.ResourceName, val.Err)
 			continue
 		}
 		wg.Add(1)
 		resourceFetcher := &resourceFetcher{
-			ResourceURI:    secret.ResourceName,
-			FileName:       secret.FileName,
-			Path:           secret.Path,
-			ExtractJSONKey: secret.ExtractJSONKey,
-			ExtractYAMLKey: secret.ExtractYAMLKey,
+			ResourceURI:       secret.ResourceName,
+			FileName:          secret.FileName,
+			Path:              secret.Path,
+			ExtractJSONKey:    secret.ExtractJSONKey,
+			ExtractYAMLKey:    secret.ExtractYAMLKey,
+			ExtractJSONPath:   secret.ExtractJSONPath,
+			ExtractYAMLPath:   secret.ExtractYAMLPath,
+			ExtractAll:        secret.ExtractAll,
+			Keys:              secret.Keys,
+			Decode:            secret.Decode,
+			Format:            secret.Format,
+			KeyFormat:         secret.KeyFormat,
+			LatestEnabled:     secret.LatestEnabled,
+			MinVersion:        secret.MinVersion,
+			Raw:               secret.Render != nil && !*secret.Render,
+			KMSKey:            secret.KMSDecrypt,
+			KMSClient:         s.KMSClient,
+			TokenSource:       mountTokenSource(creds),
+			InsecureEndpoints: s.InsecureEndpoints,
+			Certificate:       secret.Certificate,
+			Certificates:      s.Certificates,
+			PodUID:            string(cfg.PodInfo.UID),
+			Identity:          identity,
+			Cache:             s.PayloadCache,
+			Fetches:           fetches,
+			Limiter:           s.Limiter,
+			Retry:             s.RetryPolicy,
 		}
 		go resourceFetcher.Orchestrator(ctx, s, &callAuth, outputChannel, &wg)
 	}
@@ -172,6 +341,29 @@ func handleMountEvent(ctx context.Context, creds credentials.PerRPCCredentials,
 		resultMap[resourceIdentity{item.ID, item.FileName, item.Path}] = item
 
 	}
+	// Optional secrets which do not exist or cannot be accessed are replaced
+	// by their default, or left out of the mount, instead of failing it.
+	omitted := make(map[resourceIdentity]bool)
+	for _, secret := range cfg.Secrets {
+		resourceKey := resourceIdentity{secret.ResourceName, secret.FileName, secret.Path}
+		resource, ok := resultMap[resourceKey]
+		if !secret.Optional || !ok || !isOptionalError(resource.Err) {
+			continue
+		}
+		klog.InfoS("optional secret is unavailable", "resource_name", secret.ResourceName, "has_default", secret.Default != nil, "err", resource.Err.Error(), "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		if secret.Default != nil {
+			resultMap[resourceKey] = &Resource{
+				ID:       secret.ResourceName,
+				FileName: secret.FileName,
+				Path:     secret.Path,
+				Payload:  []byte(*secret.Default),
+			}
+			continue
+		}
+		delete(resultMap, resourceKey)
+		omitted[resourceKey] = true
+	}
+	renderComposites(cfg, resultMap, omitted, s.Keystores)
 	// If any access failed, return a grpc status error that includes each
 	// individual status error in the Details field.
 	//
@@ -185,22 +377,26 @@ func handleMountEvent(ctx context.Context, creds credentials.PerRPCCredentials,
 	if err := buildErr(resultMap); err != nil {
 		return nil, err
 	}
+	s.recordStalePayloads(cfg, resultMap)
 
 	out := &v1alpha1.MountResponse{}
 
 	// Add secrets to response.
-	ovs := make([]*v1alpha1.ObjectVersion, len(cfg.Secrets))
+	ovs := make([]*v1alpha1.ObjectVersion, 0, len(cfg.Secrets))
 
 	if cfg.Permissions > math.MaxInt32 {
 		return nil, fmt.Errorf("invalid file permission %d", cfg.Permissions)
 	}
-	for i, secret := range cfg.Secrets {
+	for _, secret := range cfg.Secrets {
 		// #nosec G115 Checking limit
 		mode := int32(cfg.Permissions)
 		if secret.Mode != nil {
 			mode = *secret.Mode
 		}
 		resourceKey := resourceIdentity{secret.ResourceName, secret.FileName, secret.Path}
+		if omitted[resourceKey] {
+			continue
+		}
 		resource, ok := resultMap[resourceKey]
 
 		// Should ideally never hit this if block
@@ -210,26 +406,99 @@ func handleMountEvent(ctx context.Context, creds credentials.PerRPCCredentials,
 			return nil, status.Error(codes.Internal, fmt.Sprintf("internal error: result missing for secret %v (file: %v, path: %v)", secret.ResourceName, secret.FileName, secret.Path))
 		}
 
-		out.Files = append(out.Files, &v1alpha1.File{
-			Path:     secret.PathString(),
-			Mode:     mode,
-			Contents: resource.Payload,
-		})
-		klog.V(5).InfoS("added secret to response", "resource_name", secret.ResourceName, "file_name", secret.FileName, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		if len(resource.Files) > 0 {
+			// Fanned out secrets are written as a directory with one file
+			// per key.
+			for _, f := range resource.Files {
+				fileMode := mode
+				if f.Mode != nil {
+					fileMode = *f.Mode
+				}
+				out.Files = append(out.Files, &v1alpha1.File{
+					Path:     path.Join(secret.PathString(), f.Name),
+					Mode:     fileMode,
+					Contents: f.Payload,
+				})
+			}
+		} else {
+			out.Files = append(out.Files, &v1alpha1.File{
+				Path:     secret.PathString(),
+				Mode:     mode,
+				Contents: resource.Payload,
+			})
+		}
+		klog.V(5).InfoS("added secret to response", "resource_name", objectID(secret), "file_name", secret.FileName, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
 
 		// Id:      "projects/project/secrets/test/versions/latest",
 		// Version: "projects/project/secrets/test/versions/2",
 		// Id and Version will differ only for secret manager results.
 		// They will be the same for parameter manager
-		ovs[i] = &v1alpha1.ObjectVersion{
-			Id:      secret.ResourceName,
-			Version: resource.Version,
+		version := resource.Version
+		if s.ExposePayloadChecksums {
+			version = fmt.Sprintf("%s#crc32c:%d", version, resource.Checksum)
 		}
+		ovs = append(ovs, &v1alpha1.ObjectVersion{
+			Id:      objectID(secret),
+			Version: version,
+		})
 	}
 	out.ObjectVersion = ovs
 	return out, nil
 }
 
+// isOptionalError returns true if err allows an optional secret to be left
+// out of the mount.
+func isOptionalError(err error) bool {
+	switch status.Code(err) {
+	case codes.NotFound, codes.PermissionDenied:
+		return true
+	default:
+		return false
+	}
+}
+
+// recordStalePayloads emits a warning event on the pod if any of the payloads
+// of the mount was served stale because fetching it failed.
+func (s *Server) recordStalePayloads(cfg *config.MountConfig, resultMap map[resourceIdentity]*Resource) {
+	var stale []string
+	for _, resource := range resultMap {
+		if resource.Stale && !slices.Contains(stale, resource.ID) {
+			stale = append(stale, resource.ID)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+	sort.Strings(stale)
+	klog.InfoS("mounting stale payloads", "resource_names", stale, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+	if s.EventRecorder == nil {
+		return
+	}
+	pod := &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  cfg.PodInfo.Namespace,
+		Name:       cfg.PodInfo.Name,
+		UID:        cfg.PodInfo.UID,
+	}
+	s.EventRecorder.Eventf(pod, corev1.EventTypeWarning, "StalePayloadMounted", "Fetching failed, mounted the last fetched payloads of %s", strings.Join(stale, ", "))
+}
+
+// callerIdentity returns a key identifying the credentials that are used to
+// fetch the resources of the mount. Payloads fetched with one identity are
+// never served from the PayloadCache to another.
+func callerIdentity(cfg *config.MountConfig) string {
+	switch {
+	case cfg.AuthNodePublishSecret:
+		sum := sha256.Sum256(cfg.AuthKubeSecret)
+		return "nodePublishSecretRef/" + hex.EncodeToString(sum[:])
+	case cfg.AuthProviderADC:
+		return "provider-adc"
+	default:
+		return fmt.Sprintf("pod-adc/%s/%s", cfg.PodInfo.Namespace, cfg.PodInfo.ServiceAccount)
+	}
+}
+
 // buildErr consolidates many errors into a single Status protobuf error message
 // with each individual error included into the status Details any proto. The
 // consolidated proto is converted to a general error.
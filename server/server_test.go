@@ -15,27 +15,57 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"math/big"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/infra"
 	"github.com/google/go-cmp/cmp"
+	"golang.org/x/oauth2"
 	"google.golang.org/api/option"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/credentials/oauth"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+	"software.sslmate.com/src/go-pkcs12"
 
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
 	parametermanager "cloud.google.com/go/parametermanager/apiv1"
 	"cloud.google.com/go/parametermanager/apiv1/parametermanagerpb"
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	privateca "cloud.google.com/go/security/privateca/apiv1"
+	"cloud.google.com/go/security/privateca/apiv1/privatecapb"
 )
 
 const regionalParameterVersion = "projects/project/locations/us-central1/parameters/parameterIdRegional/versions/versionId"
@@ -199,9 +229,8 @@ func TestHandleMountEvent(t *testing.T) {
 	server := &Server{
 		SecretClient:                    client,
 		ParameterManagerClient:          pmClient,
-		RegionalSecretClients:           regionalSmClients,
-		ServerClientOptions:             []option.ClientOption{},
-		RegionalParameterManagerClients: regionalPmClients,
+		RegionalSecretClients:           staticClients(regionalSmClients),
+		RegionalParameterManagerClients: staticClients(regionalPmClients),
 	}
 	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
 	if err != nil {
@@ -243,8 +272,7 @@ func TestHandleMountBothSMKeyJSONYAMLKeyProvided(t *testing.T) {
 
 	server := &Server{
 		SecretClient:          client,
-		RegionalSecretClients: regionalSmClients,
-		ServerClientOptions:   []option.ClientOption{},
+		RegionalSecretClients: staticClients(regionalSmClients),
 	}
 	_, got := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
 
@@ -286,8 +314,7 @@ func TestHandleMountBothPMKeyJSONYAMLKeyProvided(t *testing.T) {
 
 	server := &Server{
 		ParameterManagerClient:          pmClient,
-		RegionalParameterManagerClients: regionalPmClients,
-		ServerClientOptions:             []option.ClientOption{},
+		RegionalParameterManagerClients: staticClients(regionalPmClients),
 	}
 	_, got := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
 
@@ -342,9 +369,8 @@ password: password@1234`)
 	server := &Server{
 		SecretClient:                    client,
 		ParameterManagerClient:          pmClient,
-		RegionalSecretClients:           regionalSmClients,
-		RegionalParameterManagerClients: regionalPmClients,
-		ServerClientOptions:             []option.ClientOption{},
+		RegionalSecretClients:           staticClients(regionalSmClients),
+		RegionalParameterManagerClients: staticClients(regionalPmClients),
 	}
 	_, got := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
 	if !strings.Contains(got.Error(), "Internal") {
@@ -394,9 +420,8 @@ func TestHandleMountEventPMErrorSMVersionOK(t *testing.T) {
 	server := &Server{
 		SecretClient:                    client,
 		ParameterManagerClient:          pmClient,
-		RegionalSecretClients:           regionalSmClients,
-		RegionalParameterManagerClients: regionalPmClients,
-		ServerClientOptions:             []option.ClientOption{},
+		RegionalSecretClients:           staticClients(regionalSmClients),
+		RegionalParameterManagerClients: staticClients(regionalPmClients),
 	}
 	_, got := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
 	if !strings.Contains(got.Error(), "Internal") {
@@ -427,8 +452,7 @@ func TestHandleMountEventsSMInvalidLocations(t *testing.T) {
 	regionalClients := make(map[string]*secretmanager.Client)
 	server := &Server{
 		SecretClient:          client,
-		RegionalSecretClients: regionalClients,
-		ServerClientOptions:   []option.ClientOption{},
+		RegionalSecretClients: staticClients(regionalClients),
 	}
 	_, got := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
 	if !strings.Contains(got.Error(), "Invalid location") {
@@ -462,8 +486,7 @@ func TestHandleMountEventsPMInvalidLocations(t *testing.T) {
 	regionalClients := make(map[string]*parametermanager.Client)
 	server := &Server{
 		ParameterManagerClient:          client,
-		RegionalParameterManagerClients: regionalClients,
-		ServerClientOptions:             []option.ClientOption{},
+		RegionalParameterManagerClients: staticClients(regionalClients),
 	}
 	_, got := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
 	if !strings.Contains(got.Error(), "Invalid location") {
@@ -521,8 +544,7 @@ func TestHandleMountEventSMMultipleErrors(t *testing.T) {
 
 	server := &Server{
 		SecretClient:          client,
-		RegionalSecretClients: regionalClients,
-		ServerClientOptions:   []option.ClientOption{},
+		RegionalSecretClients: staticClients(regionalClients),
 	}
 	_, got := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
 	if !strings.Contains(got.Error(), "Internal") { // outermost level error
@@ -587,8 +609,7 @@ func TestHandleMountEventPMMultipleErrors(t *testing.T) {
 
 	server := &Server{
 		ParameterManagerClient:          client,
-		RegionalParameterManagerClients: regionalClients,
-		ServerClientOptions:             []option.ClientOption{},
+		RegionalParameterManagerClients: staticClients(regionalClients),
 	}
 	_, got := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
 	if !strings.Contains(got.Error(), "Internal") { // Outermost level error
@@ -682,8 +703,7 @@ func TestHandleMountEventForRegionalSecret(t *testing.T) {
 
 	server := &Server{
 		SecretClient:          client,
-		RegionalSecretClients: regionalClients,
-		ServerClientOptions:   []option.ClientOption{},
+		RegionalSecretClients: staticClients(regionalClients),
 	}
 	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
 	if err != nil {
@@ -753,8 +773,7 @@ func TestHandleMountEventForExtractJSONKey(t *testing.T) {
 	regionalClients := make(map[string]*secretmanager.Client)
 	server := &Server{
 		SecretClient:          client,
-		RegionalSecretClients: regionalClients,
-		ServerClientOptions:   []option.ClientOption{},
+		RegionalSecretClients: staticClients(regionalClients),
 	}
 	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
 	if err != nil {
@@ -826,8 +845,7 @@ func TestHandleMountEventForRegionalSecretExtractJSONKey(t *testing.T) {
 
 	server := &Server{
 		SecretClient:          regionalClient,
-		RegionalSecretClients: regionalClients,
-		ServerClientOptions:   []option.ClientOption{},
+		RegionalSecretClients: staticClients(regionalClients),
 	}
 
 	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
@@ -912,8 +930,7 @@ func TestHandleMountEventForMultipleSecretsExtractJSONKey(t *testing.T) {
 
 	server := &Server{
 		SecretClient:          client,
-		RegionalSecretClients: regionalClients,
-		ServerClientOptions:   []option.ClientOption{},
+		RegionalSecretClients: staticClients(regionalClients),
 	}
 
 	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
@@ -925,6 +942,1815 @@ func TestHandleMountEventForMultipleSecretsExtractJSONKey(t *testing.T) {
 	}
 }
 
+func TestHandleMountEventForExtractPath(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName:    "projects/project/secrets/test/versions/latest",
+				FileName:        "password.txt",
+				ExtractJSONPath: "database.primary.password",
+			},
+			{
+				ResourceName:    "projects/project/secrets/test/versions/latest",
+				FileName:        "port.txt",
+				ExtractYAMLPath: "database.primary.port",
+			},
+			{
+				ResourceName:    "projects/project/secrets/test/versions/latest",
+				FileName:        "cert.txt",
+				ExtractJSONPath: "hosts[0].cert",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, _ *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name: "projects/project/secrets/test/versions/2",
+				Payload: &secretmanagerpb.SecretPayload{
+					Data: []byte(`{"database": {"primary": {"password": "password@1234", "port": 5432}}, "hosts": [{"cert": "cert-0"}]}`),
+				},
+			}, nil
+		},
+	})
+
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+	}
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	want := []*v1alpha1.File{
+		{Path: "password.txt", Mode: 777, Contents: []byte("password@1234")},
+		{Path: "port.txt", Mode: 777, Contents: []byte("5432")},
+		{Path: "cert.txt", Mode: 777, Contents: []byte("cert-0")},
+	}
+	if diff := cmp.Diff(want, got.Files, protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected files (-want +got):\n%s", diff)
+	}
+
+	cfg.Secrets[0].ExtractJSONKey = "database"
+	_, err = handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err == nil || !strings.Contains(err.Error(), "only one of ExtractJSONKey, ExtractYAMLKey, ExtractJSONPath, ExtractYAMLPath, ExtractAll and Keys can be set") {
+		t.Errorf("handleMountEvent() got err = %v, want conflicting extraction error", err)
+	}
+}
+
+func TestHandleMountEventFanOut(t *testing.T) {
+	readOnly := int32(0400)
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/test/versions/latest",
+				Path:         "all",
+				ExtractAll:   true,
+			},
+			{
+				ResourceName: "projects/project/secrets/test/versions/latest",
+				Path:         "selected",
+				Keys: []*config.SecretKey{
+					{Key: "user"},
+					{Key: "database.password", FileName: "password", Mode: &readOnly},
+				},
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	want := &v1alpha1.MountResponse{
+		ObjectVersion: []*v1alpha1.ObjectVersion{
+			{
+				Id:      "projects/project/secrets/test/versions/latest",
+				Version: "projects/project/secrets/test/versions/2",
+			},
+			{
+				Id:      "projects/project/secrets/test/versions/latest",
+				Version: "projects/project/secrets/test/versions/2",
+			},
+		},
+		Files: []*v1alpha1.File{
+			{Path: "all/database", Mode: 777, Contents: []byte(`{"password":"password@1234"}`)},
+			{Path: "all/user", Mode: 777, Contents: []byte("admin")},
+			{Path: "selected/user", Mode: 777, Contents: []byte("admin")},
+			{Path: "selected/password", Mode: 0400, Contents: []byte("password@1234")},
+		},
+	}
+
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, _ *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name: "projects/project/secrets/test/versions/2",
+				Payload: &secretmanagerpb.SecretPayload{
+					Data: []byte(`{"user": "admin", "database": {"password": "password@1234"}}`),
+				},
+			}, nil
+		},
+	})
+
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+	}
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected response (-want +got):\n%s", diff)
+	}
+
+	cfg.Secrets[1].Keys = []*config.SecretKey{{Key: "database.password"}, {Key: "user", FileName: "../user"}}
+	_, err = handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err == nil || !strings.Contains(err.Error(), "invalid file name '../user'") {
+		t.Errorf("handleMountEvent() got err = %v, want invalid file name error", err)
+	}
+}
+
+func TestHandleMountEventDeduplicatesFetches(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/test/versions/latest",
+				FileName:     "good1.txt",
+			},
+			{
+				ResourceName:   "projects/project/secrets/test/versions/latest",
+				FileName:       "good2.txt",
+				ExtractJSONKey: "user",
+			},
+			{
+				ResourceName: "projects/project/secrets/other/versions/latest",
+				FileName:     "good3.txt",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[req.Name]++
+			// every call observes a new version, as if the secret was
+			// rotated between calls.
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name: strings.TrimSuffix(req.Name, "latest") + strconv.Itoa(calls[req.Name]),
+				Payload: &secretmanagerpb.SecretPayload{
+					Data: []byte(`{"user": "admin"}`),
+				},
+			}, nil
+		},
+	})
+
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+	}
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	for name, n := range calls {
+		if n != 1 {
+			t.Errorf("AccessSecretVersion(%q) called %d times, want 1", name, n)
+		}
+	}
+	if got.ObjectVersion[0].Version != got.ObjectVersion[1].Version {
+		t.Errorf("handleMountEvent() got versions %q and %q for the same resource, want equal", got.ObjectVersion[0].Version, got.ObjectVersion[1].Version)
+	}
+}
+
+func TestHandleMountEventRetriesTransientErrors(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/test/versions/latest",
+				FileName:     "good1.txt",
+			},
+			{
+				ResourceName: globalParameterVersion,
+				FileName:     "good2.txt",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	smCalls, pmCalls := 0, 0
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			smCalls++
+			if smCalls < 3 {
+				return nil, status.Error(codes.Unavailable, "try again")
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    "projects/project/secrets/test/versions/2",
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+	pmClient := mockParameterManagerClient(t, &mockParameterManagerServer{
+		renderFn: func(ctx context.Context, req *parametermanagerpb.RenderParameterVersionRequest) (*parametermanagerpb.RenderParameterVersionResponse, error) {
+			pmCalls++
+			if pmCalls < 2 {
+				return nil, status.Error(codes.ResourceExhausted, "quota exceeded")
+			}
+			return &parametermanagerpb.RenderParameterVersionResponse{
+				ParameterVersion: globalParameterVersion,
+				RenderedPayload:  []byte("My Parameter"),
+			}, nil
+		},
+	})
+
+	server := &Server{
+		SecretClient:                    client,
+		ParameterManagerClient:          pmClient,
+		RegionalSecretClients:           staticClients(make(map[string]*secretmanager.Client)),
+		RegionalParameterManagerClients: staticClients(make(map[string]*parametermanager.Client)),
+		RetryPolicy: &infra.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+			Multiplier:     2,
+			RetryableCodes: []codes.Code{codes.Unavailable, codes.ResourceExhausted},
+		},
+	}
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	if string(got.Files[0].Contents) != "My Secret" || string(got.Files[1].Contents) != "My Parameter" {
+		t.Errorf("handleMountEvent() got files %v, want secret and parameter contents", got.Files)
+	}
+	if smCalls != 3 || pmCalls != 2 {
+		t.Errorf("handleMountEvent() made %d secretmanager and %d parametermanager calls, want 3 and 2", smCalls, pmCalls)
+	}
+
+	// secretmanager fails twice, which exceeds a single retry.
+	smCalls, pmCalls = 0, 0
+	server.RetryPolicy.MaxAttempts = 2
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil {
+		t.Errorf("handleMountEvent() got err = nil, want error after exhausting retries")
+	}
+}
+
+func TestHandleMountEventPayloadCache(t *testing.T) {
+	newCfg := func(serviceAccount string) *config.MountConfig {
+		return &config.MountConfig{
+			Secrets: []*config.Secret{
+				{
+					ResourceName: "projects/project/secrets/test/versions/7",
+					FileName:     "good1.txt",
+				},
+			},
+			Permissions: 777,
+			PodInfo: &config.PodInfo{
+				Namespace:      "default",
+				Name:           "test-pod",
+				ServiceAccount: serviceAccount,
+			},
+		}
+	}
+
+	calls := 0
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			calls++
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name: req.Name,
+				Payload: &secretmanagerpb.SecretPayload{
+					Data: []byte("My Secret"),
+				},
+			}, nil
+		},
+	})
+
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+		PayloadCache:          NewPayloadCache(10, time.Minute, 0, 0),
+	}
+
+	for _, sa := range []string{"sa-a", "sa-a", "sa-b"} {
+		got, err := handleMountEvent(context.Background(), NewFakeCreds(), newCfg(sa), server)
+		if err != nil {
+			t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+		}
+		if string(got.Files[0].Contents) != "My Secret" {
+			t.Errorf("handleMountEvent() got contents = %q, want %q", got.Files[0].Contents, "My Secret")
+		}
+	}
+	// The second mount for sa-a is served from the cache, sa-b must fetch
+	// with its own credentials.
+	if calls != 2 {
+		t.Errorf("AccessSecretVersion called %d times, want 2", calls)
+	}
+}
+
+func TestHandleMountEventPayloadChecksum(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/test/versions/latest",
+				FileName:     "good1.txt",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	data := []byte("My Secret")
+	checksum := int64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+
+	tests := []struct {
+		name        string
+		dataCrc32C  *int64
+		wantCode    codes.Code
+		wantVersion []*v1alpha1.ObjectVersion
+	}{
+		{
+			name:       "matching checksum",
+			dataCrc32C: &checksum,
+			wantCode:   codes.OK,
+			wantVersion: []*v1alpha1.ObjectVersion{
+				{
+					Id:      "projects/project/secrets/test/versions/latest",
+					Version: "projects/project/secrets/test/versions/2#crc32c:" + strconv.FormatInt(checksum, 10),
+				},
+			},
+		},
+		{
+			name:       "missing checksum",
+			dataCrc32C: nil,
+			wantCode:   codes.OK,
+			wantVersion: []*v1alpha1.ObjectVersion{
+				{
+					Id:      "projects/project/secrets/test/versions/latest",
+					Version: "projects/project/secrets/test/versions/2#crc32c:" + strconv.FormatInt(checksum, 10),
+				},
+			},
+		},
+		{
+			name:       "mismatched checksum",
+			dataCrc32C: proto.Int64(checksum + 1),
+			wantCode:   codes.DataLoss,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name: "projects/project/secrets/test/versions/2",
+						Payload: &secretmanagerpb.SecretPayload{
+							Data:       data,
+							DataCrc32C: tc.dataCrc32C,
+						},
+					}, nil
+				},
+			})
+			server := &Server{
+				SecretClient:           client,
+				RegionalSecretClients:  staticClients(make(map[string]*secretmanager.Client)),
+				ExposePayloadChecksums: true,
+			}
+
+			got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+			if tc.wantCode != codes.OK {
+				if err == nil {
+					t.Fatalf("handleMountEvent() got err = nil, want %v", tc.wantCode)
+				}
+				details := status.Convert(err).Details()
+				if len(details) != 1 || codes.Code(details[0].(*spb.Status).Code) != tc.wantCode {
+					t.Errorf("handleMountEvent() got err = %v, want detail with code %v", err, tc.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+			}
+			if diff := cmp.Diff(tc.wantVersion, got.ObjectVersion, protocmp.Transform()); diff != "" {
+				t.Errorf("handleMountEvent() returned unexpected object versions (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleMountEventStaleOnError(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/test/versions/latest",
+				FileName:     "good1.txt",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace:      "default",
+			Name:           "test-pod",
+			ServiceAccount: "sa",
+		},
+	}
+
+	var accessErr error
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if accessErr != nil {
+				return nil, accessErr
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    "projects/project/secrets/test/versions/2",
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+
+	recorder := record.NewFakeRecorder(10)
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+		PayloadCache:          NewPayloadCache(10, 0, 0, time.Hour),
+		EventRecorder:         recorder,
+		// a single attempt, instead of the client library retries
+		RetryPolicy: &infra.RetryPolicy{MaxAttempts: 1},
+	}
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+
+	accessErr = status.Error(codes.Unavailable, "regional outage")
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() during outage got err = %v, want stale payload", err)
+	}
+	if string(got.Files[0].Contents) != "My Secret" || got.ObjectVersion[0].Version != "projects/project/secrets/test/versions/2" {
+		t.Errorf("handleMountEvent() during outage got %v, want last fetched payload", got)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "StalePayloadMounted") {
+			t.Errorf("handleMountEvent() emitted event %q, want StalePayloadMounted", event)
+		}
+	default:
+		t.Errorf("handleMountEvent() emitted no event for stale payload")
+	}
+
+	// Permanent errors such as revoked access are never answered from the
+	// cache.
+	accessErr = status.Error(codes.PermissionDenied, "access revoked")
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil {
+		t.Errorf("handleMountEvent() with revoked access got err = nil, want error")
+	}
+	accessErr = status.Error(codes.Internal, "internal error")
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil {
+		t.Errorf("handleMountEvent() with internal error got err = nil, want error")
+	}
+}
+
+func TestHandleMountEventStaleOnErrorLatestEnabled(t *testing.T) {
+	const secret = "projects/project/secrets/test"
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName:  secret + "/versions/latest",
+				FileName:      "good1.txt",
+				LatestEnabled: true,
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace:      "default",
+			Name:           "test-pod",
+			ServiceAccount: "sa",
+		},
+	}
+
+	var listErr, accessErr error
+	client := mock(t, &mockSecretServer{
+		listVersionsFn: func(ctx context.Context, req *secretmanagerpb.ListSecretVersionsRequest) (*secretmanagerpb.ListSecretVersionsResponse, error) {
+			if listErr != nil {
+				return nil, listErr
+			}
+			return &secretmanagerpb.ListSecretVersionsResponse{
+				Versions: []*secretmanagerpb.SecretVersion{{Name: secret + "/versions/2", State: secretmanagerpb.SecretVersion_ENABLED}},
+			}, nil
+		},
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if accessErr != nil {
+				return nil, accessErr
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.GetName(),
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+		PayloadCache:          NewPayloadCache(10, 0, 0, time.Hour),
+		RetryPolicy:           &infra.RetryPolicy{MaxAttempts: 1},
+	}
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+
+	for _, tc := range []struct {
+		name               string
+		listErr, accessErr error
+	}{
+		{name: "list failure", listErr: status.Error(codes.Unavailable, "regional outage")},
+		{name: "access failure", accessErr: status.Error(codes.Unavailable, "regional outage")},
+	} {
+		listErr, accessErr = tc.listErr, tc.accessErr
+		got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+		if err != nil {
+			t.Fatalf("handleMountEvent() with %s got err = %v, want stale payload", tc.name, err)
+		}
+		if string(got.Files[0].Contents) != "My Secret" || got.ObjectVersion[0].Version != secret+"/versions/2" {
+			t.Errorf("handleMountEvent() with %s got %v, want last fetched payload", tc.name, got)
+		}
+	}
+}
+
+func TestHandleMountEventOptionalSecrets(t *testing.T) {
+	defaultFlags := "enabled: false"
+	newCfg := func() *config.MountConfig {
+		return &config.MountConfig{
+			Secrets: []*config.Secret{
+				{
+					ResourceName: "projects/project/secrets/test/versions/latest",
+					FileName:     "required.txt",
+				},
+				{
+					ResourceName: "projects/project/secrets/missing/versions/latest",
+					FileName:     "ca-secondary.pem",
+					Optional:     true,
+				},
+				{
+					ResourceName: "projects/project/secrets/denied/versions/latest",
+					FileName:     "flags.yaml",
+					Optional:     true,
+					Default:      &defaultFlags,
+				},
+			},
+			Permissions: 777,
+			PodInfo: &config.PodInfo{
+				Namespace: "default",
+				Name:      "test-pod",
+			},
+		}
+	}
+
+	errs := map[string]error{
+		"projects/project/secrets/missing/versions/latest": status.Error(codes.NotFound, "secret not found"),
+		"projects/project/secrets/denied/versions/latest":  status.Error(codes.PermissionDenied, "permission denied"),
+	}
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if err, ok := errs[req.Name]; ok {
+				return nil, err
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    strings.TrimSuffix(req.Name, "latest") + "2",
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+		RetryPolicy:           &infra.RetryPolicy{MaxAttempts: 1},
+	}
+
+	want := &v1alpha1.MountResponse{
+		ObjectVersion: []*v1alpha1.ObjectVersion{
+			{
+				Id:      "projects/project/secrets/test/versions/latest",
+				Version: "projects/project/secrets/test/versions/2",
+			},
+			{
+				Id: "projects/project/secrets/denied/versions/latest",
+			},
+		},
+		Files: []*v1alpha1.File{
+			{Path: "required.txt", Mode: 777, Contents: []byte("My Secret")},
+			{Path: "flags.yaml", Mode: 777, Contents: []byte(defaultFlags)},
+		},
+	}
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), newCfg(), server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected response (-want +got):\n%s", diff)
+	}
+
+	// Other errors of optional secrets still fail the mount.
+	errs["projects/project/secrets/missing/versions/latest"] = status.Error(codes.Unavailable, "unavailable")
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), newCfg(), server); err == nil {
+		t.Errorf("handleMountEvent() with unavailable optional secret got err = nil, want error")
+	}
+
+	// Required secrets are all-or-nothing.
+	errs["projects/project/secrets/missing/versions/latest"] = status.Error(codes.NotFound, "secret not found")
+	cfg := newCfg()
+	cfg.Secrets[1].Optional = false
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil {
+		t.Errorf("handleMountEvent() with missing required secret got err = nil, want error")
+	}
+}
+
+func TestHandleMountEventDecode(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName:   "projects/project/secrets/test/versions/latest",
+				FileName:       "keystore.bin",
+				ExtractJSONKey: "keystore",
+				Decode:         "base64",
+			},
+			{
+				ResourceName:   "projects/project/secrets/test/versions/latest",
+				FileName:       "user.txt",
+				ExtractJSONKey: "user",
+				Decode:         "base64",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, _ *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name: "projects/project/secrets/test/versions/2",
+				Payload: &secretmanagerpb.SecretPayload{
+					Data: []byte(`{"keystore": "AAEC/w==", "user": "admin"}`),
+				},
+			}, nil
+		},
+	})
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+	}
+
+	_, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err == nil || !strings.Contains(err.Error(), "user.txt") || !strings.Contains(err.Error(), "failed to decode payload as base64") {
+		t.Errorf("handleMountEvent() got err = %v, want decode error for user.txt", err)
+	}
+
+	cfg.Secrets = cfg.Secrets[:1]
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	if want := []byte{0, 1, 2, 255}; !bytes.Equal(got.Files[0].Contents, want) {
+		t.Errorf("handleMountEvent() got contents = %v, want %v", got.Files[0].Contents, want)
+	}
+}
+
+func TestHandleMountEventTemplate(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/user/versions/latest",
+				FileName:     "user.txt",
+				Alias:        "user",
+			},
+			{
+				ResourceName:   "projects/project/secrets/db/versions/latest",
+				FileName:       "password.txt",
+				ExtractJSONKey: "password",
+				Alias:          "db_password",
+			},
+			{
+				FileName: ".pgpass",
+				Template: "db:5432:app:{{ .user }}:{{ .db_password }}\n",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	dbVersion := "1"
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if req.GetName() == "projects/project/secrets/user/versions/latest" {
+				return &secretmanagerpb.AccessSecretVersionResponse{
+					Name:    "projects/project/secrets/user/versions/3",
+					Payload: &secretmanagerpb.SecretPayload{Data: []byte("admin")},
+				}, nil
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    "projects/project/secrets/db/versions/" + dbVersion,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte(`{"password": "s3cr3t"}`)},
+			}, nil
+		},
+	})
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+	}
+
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	if want := "db:5432:app:admin:s3cr3t\n"; string(got.Files[2].Contents) != want {
+		t.Errorf("handleMountEvent() got contents = %q, want %q", got.Files[2].Contents, want)
+	}
+	wantVersion := &v1alpha1.ObjectVersion{
+		Id:      "template:.pgpass",
+		Version: "db_password=projects/project/secrets/db/versions/1,user=projects/project/secrets/user/versions/3",
+	}
+	if diff := cmp.Diff(wantVersion, got.ObjectVersion[2], protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected template version (-want +got):\n%s", diff)
+	}
+
+	dbVersion = "2"
+	got, err = handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	if got.ObjectVersion[2].Version == wantVersion.Version {
+		t.Errorf("handleMountEvent() template version did not change when an input was rotated")
+	}
+
+	cfg.Secrets[2].Template = "{{ .missing }}"
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("handleMountEvent() got err = %v, want error for missing alias", err)
+	}
+}
+
+func TestHandleMountEventCompositeVersions(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/db/versions/latest",
+				FileName:     "db.txt",
+				Alias:        "db",
+			},
+			{
+				ResourceName: "projects/project/secrets/api/versions/latest",
+				FileName:     "api.txt",
+				Alias:        "api",
+			},
+			{
+				FileName: "db.conf",
+				Template: "{{ with $.db }}password={{ . }}{{ end }}\n",
+			},
+			{
+				FileName: "db.env",
+				Format:   "dotenv",
+				Aliases:  []string{"db"},
+			},
+			{
+				FileName: "all.conf",
+				Template: "{{ range $k, $v := . }}{{ $k }}={{ $v }}\n{{ end }}",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	versions := map[string]string{"db": "1", "api": "1"}
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			name := strings.Split(req.GetName(), "/")[3]
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    fmt.Sprintf("projects/project/secrets/%s/versions/%s", name, versions[name]),
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte(name + "-" + versions[name])},
+			}, nil
+		},
+	})
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+	}
+	mount := func() []*v1alpha1.ObjectVersion {
+		t.Helper()
+		got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+		if err != nil {
+			t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+		}
+		return got.ObjectVersion
+	}
+
+	want := []*v1alpha1.ObjectVersion{
+		{Id: "projects/project/secrets/db/versions/latest", Version: "projects/project/secrets/db/versions/1"},
+		{Id: "projects/project/secrets/api/versions/latest", Version: "projects/project/secrets/api/versions/1"},
+		{Id: "template:db.conf", Version: "db=projects/project/secrets/db/versions/1"},
+		{Id: "dotenv:db.env", Version: "db=projects/project/secrets/db/versions/1"},
+		{Id: "template:all.conf", Version: "api=projects/project/secrets/api/versions/1,db=projects/project/secrets/db/versions/1"},
+	}
+	if diff := cmp.Diff(want, mount(), protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected versions (-want +got):\n%s", diff)
+	}
+
+	// Rotating api only changes the composite consuming the whole data.
+	versions["api"] = "2"
+	want[1].Version = "projects/project/secrets/api/versions/2"
+	want[4].Version = "api=projects/project/secrets/api/versions/2,db=projects/project/secrets/db/versions/1"
+	if diff := cmp.Diff(want, mount(), protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected versions after rotating an unrelated alias (-want +got):\n%s", diff)
+	}
+
+	versions["db"] = "2"
+	want[0].Version = "projects/project/secrets/db/versions/2"
+	want[2].Version = "db=projects/project/secrets/db/versions/2"
+	want[3].Version = "db=projects/project/secrets/db/versions/2"
+	want[4].Version = "api=projects/project/secrets/api/versions/2,db=projects/project/secrets/db/versions/2"
+	if diff := cmp.Diff(want, mount(), protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected versions after rotating a consumed alias (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandleMountEventDotenv(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/db/versions/latest",
+				FileName:     "db.env",
+				Format:       "dotenv",
+			},
+			{
+				ResourceName: "projects/project/secrets/db/versions/latest",
+				FileName:     "selected.env",
+				Keys:         []*config.SecretKey{{Key: "password", FileName: "DB_PASSWORD"}},
+				Format:       "dotenv",
+			},
+			{
+				ResourceName: "projects/project/secrets/token/versions/latest",
+				FileName:     "token.txt",
+				Alias:        "API_TOKEN",
+			},
+			{
+				ResourceName: "projects/project/secrets/db/versions/latest",
+				FileName:     "db",
+				ExtractAll:   true,
+				Alias:        "db",
+			},
+			{
+				FileName: "app.env",
+				Format:   "dotenv",
+				Aliases:  []string{"API_TOKEN", "db"},
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if req.GetName() == "projects/project/secrets/token/versions/latest" {
+				return &secretmanagerpb.AccessSecretVersionResponse{
+					Name:    "projects/project/secrets/token/versions/1",
+					Payload: &secretmanagerpb.SecretPayload{Data: []byte("abc def")},
+				}, nil
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    "projects/project/secrets/db/versions/1",
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte(`{"DB_USER": "admin", "password": "it's"}`)},
+			}, nil
+		},
+	})
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+	}
+
+	cfg.Secrets[0].Format = "ini"
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil || !strings.Contains(err.Error(), "unsupported format value 'ini'") {
+		t.Errorf("handleMountEvent() got err = %v, want unsupported format error", err)
+	}
+
+	cfg.Secrets[0].Format = "dotenv"
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	want := map[string]string{
+		"db.env":       "DB_USER=admin\npassword='it'\\''s'\n",
+		"selected.env": "DB_PASSWORD='it'\\''s'\n",
+		"app.env":      "API_TOKEN='abc def'\nDB_USER=admin\npassword='it'\\''s'\n",
+	}
+	seen := 0
+	for _, f := range got.Files {
+		w, ok := want[f.Path]
+		if !ok {
+			continue
+		}
+		seen++
+		if string(f.Contents) != w {
+			t.Errorf("handleMountEvent() got %s = %q, want %q", f.Path, f.Contents, w)
+		}
+	}
+	if seen != len(want) {
+		t.Errorf("handleMountEvent() got %d of the %d env files", seen, len(want))
+	}
+	if got.ObjectVersion[4].Id != "dotenv:app.env" {
+		t.Errorf("handleMountEvent() got Id = %q, want %q", got.ObjectVersion[4].Id, "dotenv:app.env")
+	}
+}
+
+func TestHandleMountEventKMSDecrypt(t *testing.T) {
+	const cryptoKey = "projects/project/locations/global/keyRings/ring/cryptoKeys/key"
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName:   "projects/project/secrets/test/versions/latest",
+				FileName:       "plaintext.txt",
+				ExtractJSONKey: "ciphertext",
+				Decode:         "base64",
+				KMSDecrypt:     cryptoKey,
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, _ *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    "projects/project/secrets/test/versions/2",
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte(`{"ciphertext": "ZW5jOmhlbGxv"}`)},
+			}, nil
+		},
+	})
+	corrupt := false
+	kmsClient := mockKMSClient(t, &mockKMSServer{
+		decryptFn: func(ctx context.Context, req *kmspb.DecryptRequest) (*kmspb.DecryptResponse, error) {
+			if req.GetName() != cryptoKey {
+				return nil, status.Errorf(codes.NotFound, "key %s not found", req.GetName())
+			}
+			if int64(crc32.Checksum(req.GetCiphertext(), crc32cTable)) != req.GetCiphertextCrc32C().GetValue() {
+				return nil, status.Error(codes.InvalidArgument, "ciphertext checksum mismatch")
+			}
+			plaintext := bytes.TrimPrefix(req.GetCiphertext(), []byte("enc:"))
+			crc := int64(crc32.Checksum(plaintext, crc32cTable))
+			if corrupt {
+				crc++
+			}
+			return &kmspb.DecryptResponse{Plaintext: plaintext, PlaintextCrc32C: wrapperspb.Int64(crc)}, nil
+		},
+	})
+	server := &Server{
+		SecretClient:          client,
+		KMSClient:             kmsClient,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+	}
+
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	if want := "hello"; string(got.Files[0].Contents) != want {
+		t.Errorf("handleMountEvent() got contents = %q, want %q", got.Files[0].Contents, want)
+	}
+
+	corrupt = true
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil || !strings.Contains(err.Error(), "plaintext checksum mismatch") {
+		t.Errorf("handleMountEvent() got err = %v, want plaintext checksum mismatch", err)
+	}
+
+	cfg.Secrets[0].KMSDecrypt = "projects/project/locations/global/keyRings/ring"
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil || !strings.Contains(err.Error(), "invalid kmsDecrypt key") {
+		t.Errorf("handleMountEvent() got err = %v, want invalid key error", err)
+	}
+}
+
+func TestHandleMountEventKMSDecryptCached(t *testing.T) {
+	const cryptoKey = "projects/project/locations/global/keyRings/ring/cryptoKeys/key"
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/test/versions/latest",
+				FileName:     "a.txt",
+				KMSDecrypt:   cryptoKey,
+			},
+			{
+				ResourceName: "projects/project/secrets/test/versions/latest",
+				FileName:     "b.txt",
+				KMSDecrypt:   cryptoKey,
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	ciphertext := "enc:hello"
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, _ *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    "projects/project/secrets/test/versions/2",
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte(ciphertext)},
+			}, nil
+		},
+	})
+	var decrypts atomic.Int32
+	kmsClient := mockKMSClient(t, &mockKMSServer{
+		decryptFn: func(ctx context.Context, req *kmspb.DecryptRequest) (*kmspb.DecryptResponse, error) {
+			decrypts.Add(1)
+			return &kmspb.DecryptResponse{Plaintext: bytes.TrimPrefix(req.GetCiphertext(), []byte("enc:"))}, nil
+		},
+	})
+	server := &Server{
+		SecretClient:          client,
+		KMSClient:             kmsClient,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+		PayloadCache:          NewPayloadCache(10, time.Hour, 0, 0),
+	}
+
+	for i := 0; i < 2; i++ {
+		got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+		if err != nil {
+			t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+		}
+		for _, f := range got.Files {
+			if string(f.Contents) != "hello" {
+				t.Errorf("mount %d: handleMountEvent() got contents of %s = %q, want %q", i, f.Path, f.Contents, "hello")
+			}
+		}
+		if got := decrypts.Load(); got != 1 {
+			t.Errorf("mount %d: handleMountEvent() made %d Decrypt calls, want 1", i, got)
+		}
+	}
+
+	// Plaintexts are only served to the identity which decrypted them.
+	cfg.PodInfo.ServiceAccount = "other"
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	if got := decrypts.Load(); got != 2 {
+		t.Errorf("handleMountEvent() made %d Decrypt calls for another identity, want 2", got)
+	}
+}
+
+func TestHandleMountEventStorageObject(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "gs://bucket/dir/license.txt",
+				FileName:     "license.txt",
+			},
+			{
+				ResourceName: "projects/_/buckets/bucket/objects/dir/license.txt#3",
+				FileName:     "license-3.txt",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	var mu sync.Mutex
+	objects := map[string]string{"1712": "current license", "3": "old license"}
+	live := "1712"
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer storage-token" {
+			http.Error(w, "missing credentials", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.EscapedPath() != "/storage/v1/b/bucket/o/dir%2Flicense.txt" || r.URL.Query().Get("alt") != "media" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		mu.Lock()
+		generation := r.URL.Query().Get("generation")
+		if generation == "" {
+			generation = live
+		}
+		mu.Unlock()
+		content, ok := objects[generation]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-Goog-Generation", generation)
+		io.WriteString(w, content)
+	}))
+	defer ts.Close()
+
+	server := &Server{
+		StorageClient: &StorageClient{HTTPClient: ts.Client(), Endpoint: ts.URL, MaxObjectSize: 16},
+	}
+	// The credentials built by Mount, which need the information of a gRPC
+	// call to produce request metadata.
+	creds := oauth.TokenSource{TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "storage-token"})}
+
+	got, err := handleMountEvent(context.Background(), creds, cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	want := &v1alpha1.MountResponse{
+		ObjectVersion: []*v1alpha1.ObjectVersion{
+			{Id: "gs://bucket/dir/license.txt", Version: "1712"},
+			{Id: "projects/_/buckets/bucket/objects/dir/license.txt#3", Version: "3"},
+		},
+		Files: []*v1alpha1.File{
+			{Path: "license.txt", Mode: 777, Contents: []byte("current license")},
+			{Path: "license-3.txt", Mode: 777, Contents: []byte("old license")},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected response (-want +got):\n%s", diff)
+	}
+
+	// A new live generation is reported as a new version.
+	mu.Lock()
+	objects["1713"] = "a much longer license"
+	live = "1713"
+	mu.Unlock()
+	if _, err := handleMountEvent(context.Background(), creds, cfg, server); err == nil || !strings.Contains(err.Error(), "exceeds the limit of 16 bytes") {
+		t.Errorf("handleMountEvent() got err = %v, want size limit error", err)
+	}
+	server.StorageClient.MaxObjectSize = 0
+	got, err = handleMountEvent(context.Background(), creds, cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	if got.ObjectVersion[0].Version != "1713" {
+		t.Errorf("handleMountEvent() got version %q, want 1713", got.ObjectVersion[0].Version)
+	}
+
+	cfg.Secrets[0].ResourceName = "gs://bucket/missing.txt"
+	if _, err := handleMountEvent(context.Background(), creds, cfg, server); err == nil || !strings.Contains(err.Error(), "NotFound") {
+		t.Errorf("handleMountEvent() got err = %v, want NotFound", err)
+	}
+
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); status.Code(err) != codes.Internal || !strings.Contains(err.Error(), "no token source") {
+		t.Errorf("handleMountEvent() got err = %v, want missing token source error", err)
+	}
+
+	server.StorageClient = nil
+	if _, err := handleMountEvent(context.Background(), creds, cfg, server); err == nil || !strings.Contains(err.Error(), "no Cloud Storage client is configured") {
+		t.Errorf("handleMountEvent() got err = %v, want unsupported error", err)
+	}
+}
+
+func TestHandleMountEventCertificate(t *testing.T) {
+	const caPool = "projects/project/locations/us-central1/caPools/pool"
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: caPool,
+				Path:         "mtls",
+				Certificate: &config.CertificateRequest{
+					Template:   "projects/project/locations/us-central1/certificateTemplates/client",
+					CommonName: "client",
+					Lifetime:   "1h",
+				},
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+			UID:       "123",
+		},
+	}
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, rootKey.Public(), rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCert, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER})
+
+	var calls int64
+	caClient := mockCAClient(t, &mockCAServer{
+		createCertificateFn: func(ctx context.Context, req *privatecapb.CreateCertificateRequest) (*privatecapb.Certificate, error) {
+			calls++
+			if req.GetParent() != caPool || req.GetCertificate().GetCertificateTemplate() != cfg.Secrets[0].Certificate.Template || req.GetRequestId() == "" {
+				return nil, status.Errorf(codes.InvalidArgument, "unexpected request %v", req)
+			}
+			block, _ := pem.Decode([]byte(req.GetCertificate().GetPemCsr()))
+			if block == nil {
+				return nil, status.Error(codes.InvalidArgument, "invalid CSR")
+			}
+			csr, err := x509.ParseCertificateRequest(block.Bytes)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			notBefore := time.Now()
+			leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+				SerialNumber: big.NewInt(calls + 1),
+				Subject:      csr.Subject,
+				NotBefore:    notBefore,
+				NotAfter:     notBefore.Add(req.GetCertificate().GetLifetime().AsDuration()),
+			}, rootCert, csr.PublicKey, rootKey)
+			if err != nil {
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+			return &privatecapb.Certificate{
+				PemCertificate:      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})),
+				PemCertificateChain: []string{string(root)},
+			}, nil
+		},
+	})
+	server := &Server{
+		CAClient:     caClient,
+		Certificates: NewCertificateStore(),
+	}
+
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range got.Files {
+		files[f.Path] = f.Contents
+	}
+	pair, err := tls.X509KeyPair(files["mtls/tls.crt"], files["mtls/tls.key"])
+	if err != nil {
+		t.Fatalf("handleMountEvent() returned a mismatched key pair: %v", err)
+	}
+	if !bytes.Equal(files["mtls/ca.crt"], root) {
+		t.Errorf("handleMountEvent() got ca.crt %q, want the root certificate", files["mtls/ca.crt"])
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantVersion := fmt.Sprintf("2/%s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	if len(got.ObjectVersion) != 1 || got.ObjectVersion[0].Version != wantVersion {
+		t.Errorf("handleMountEvent() got object versions %v, want version %q", got.ObjectVersion, wantVersion)
+	}
+
+	// The certificate is reused until two thirds of its lifetime passed.
+	again, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	if calls != 1 || again.ObjectVersion[0].Version != wantVersion || !bytes.Equal(again.Files[1].Contents, got.Files[1].Contents) {
+		t.Errorf("handleMountEvent() re-issued the certificate before it was due for renewal")
+	}
+	server.Certificates.now = func() time.Time { return time.Now().Add(45 * time.Minute) }
+	renewed, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	if calls != 2 || renewed.ObjectVersion[0].Version == wantVersion {
+		t.Errorf("handleMountEvent() got version %q after %d calls, want a renewed certificate", renewed.ObjectVersion[0].Version, calls)
+	}
+
+	cfg.Secrets[0].Decode = "base64"
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil || !strings.Contains(err.Error(), "issued certificates cannot be combined") {
+		t.Errorf("handleMountEvent() got err = %v, want unsupported option error", err)
+	}
+	cfg.Secrets[0].Decode = ""
+	server.CAClient = nil
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil || !strings.Contains(err.Error(), "no Certificate Authority Service client is configured") {
+		t.Errorf("handleMountEvent() got err = %v, want unsupported error", err)
+	}
+}
+
+func TestHandleMountEventSelector(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				Path: "payments",
+				Selector: &config.SecretSelector{
+					Project:       "project",
+					LabelSelector: map[string]string{"team": "payments"},
+					NamePrefix:    "db-",
+				},
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	var filters []string
+	client := mock(t, &mockSecretServer{
+		listFn: func(ctx context.Context, req *secretmanagerpb.ListSecretsRequest) (*secretmanagerpb.ListSecretsResponse, error) {
+			if req.GetParent() != "projects/project" {
+				return nil, status.Errorf(codes.NotFound, "%s not found", req.GetParent())
+			}
+			filters = append(filters, req.GetFilter())
+			if req.GetPageToken() == "" {
+				return &secretmanagerpb.ListSecretsResponse{
+					Secrets: []*secretmanagerpb.Secret{
+						{Name: "projects/project/secrets/db-password", Labels: map[string]string{"team": "payments"}},
+						{Name: "projects/project/secrets/legacy-db-user", Labels: map[string]string{"team": "payments"}},
+					},
+					NextPageToken: "page2",
+				}, nil
+			}
+			return &secretmanagerpb.ListSecretsResponse{
+				Secrets: []*secretmanagerpb.Secret{
+					{Name: "projects/project/secrets/db-user", Labels: map[string]string{"team": "payments"}},
+					{Name: "projects/project/secrets/db-admin", Labels: map[string]string{"team": "payments-admin"}},
+				},
+			}, nil
+		},
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			name := strings.TrimSuffix(req.GetName(), "/versions/latest")
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    name + "/versions/1",
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte(path.Base(name))},
+			}, nil
+		},
+	})
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+		MaxSelectedSecrets:    2,
+	}
+
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	want := &v1alpha1.MountResponse{
+		ObjectVersion: []*v1alpha1.ObjectVersion{
+			{Id: "projects/project/secrets/db-password/versions/latest", Version: "projects/project/secrets/db-password/versions/1"},
+			{Id: "projects/project/secrets/db-user/versions/latest", Version: "projects/project/secrets/db-user/versions/1"},
+		},
+		Files: []*v1alpha1.File{
+			{Path: "payments/db-password", Mode: 777, Contents: []byte("db-password")},
+			{Path: "payments/db-user", Mode: 777, Contents: []byte("db-user")},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected response (-want +got):\n%s", diff)
+	}
+	if want := "name:db- AND labels.team:payments"; filters[0] != want {
+		t.Errorf("ListSecrets() got filter %q, want %q", filters[0], want)
+	}
+	if len(cfg.Secrets) != 1 || cfg.Secrets[0].Selector == nil {
+		t.Errorf("handleMountEvent() modified the selector entry of the mount config")
+	}
+
+	cfg.Secrets[0].Selector.LabelSelector = nil
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil || !strings.Contains(err.Error(), "selectors of the mount match more than 2 secrets") {
+		t.Errorf("handleMountEvent() got err = %v, want selector limit error", err)
+	}
+
+	// The limit applies to the selectors of the mount in total.
+	cfg.Secrets[0].Selector.LabelSelector = map[string]string{"team": "payments"}
+	cfg.Secrets = append(cfg.Secrets, &config.Secret{
+		Path: "legacy",
+		Selector: &config.SecretSelector{
+			Project:    "project",
+			NamePrefix: "legacy-",
+		},
+	})
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil || !strings.Contains(err.Error(), "selectors of the mount match more than 2 secrets") {
+		t.Errorf("handleMountEvent() got err = %v, want selector limit error across selectors", err)
+	}
+	cfg.Secrets = cfg.Secrets[:1]
+
+	cfg.Secrets[0].Selector.Project = "other"
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); status.Code(err) != codes.NotFound {
+		t.Errorf("handleMountEvent() got err = %v, want NotFound", err)
+	}
+}
+
+func TestHandleMountEventLatestEnabled(t *testing.T) {
+	const secret = "projects/project/secrets/test"
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName:  secret + "/versions/latest",
+				FileName:      "good1.txt",
+				LatestEnabled: true,
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	states := map[string]secretmanagerpb.SecretVersion_State{
+		"1": secretmanagerpb.SecretVersion_ENABLED,
+		"2": secretmanagerpb.SecretVersion_ENABLED,
+		"3": secretmanagerpb.SecretVersion_DISABLED,
+	}
+	client := mock(t, &mockSecretServer{
+		listVersionsFn: func(ctx context.Context, req *secretmanagerpb.ListSecretVersionsRequest) (*secretmanagerpb.ListSecretVersionsResponse, error) {
+			if req.GetParent() != secret || req.GetFilter() != "state:ENABLED" {
+				return nil, status.Errorf(codes.InvalidArgument, "unexpected request %v", req)
+			}
+			resp := &secretmanagerpb.ListSecretVersionsResponse{}
+			for _, id := range []string{"3", "2", "1"} {
+				if states[id] == secretmanagerpb.SecretVersion_ENABLED {
+					resp.Versions = append(resp.Versions, &secretmanagerpb.SecretVersion{Name: secret + "/versions/" + id, State: states[id]})
+				}
+			}
+			return resp, nil
+		},
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if path.Base(req.GetName()) == "latest" || states[path.Base(req.GetName())] != secretmanagerpb.SecretVersion_ENABLED {
+				return nil, status.Errorf(codes.FailedPrecondition, "%s is in DISABLED state", req.GetName())
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.GetName(),
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("version " + path.Base(req.GetName()))},
+			}, nil
+		},
+	})
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+	}
+
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	want := &v1alpha1.MountResponse{
+		ObjectVersion: []*v1alpha1.ObjectVersion{
+			{Id: secret + "/versions/latest", Version: secret + "/versions/2"},
+		},
+		Files: []*v1alpha1.File{
+			{Path: "good1.txt", Mode: 777, Contents: []byte("version 2")},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected response (-want +got):\n%s", diff)
+	}
+
+	cfg.Secrets[0].MinVersion = 3
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil || !strings.Contains(err.Error(), "older than minVersion 3") {
+		t.Errorf("handleMountEvent() got err = %v, want minVersion error", err)
+	}
+
+	cfg.Secrets[0].MinVersion = 0
+	for id := range states {
+		states[id] = secretmanagerpb.SecretVersion_DISABLED
+	}
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil || !strings.Contains(err.Error(), "no enabled version") {
+		t.Errorf("handleMountEvent() got err = %v, want no enabled version error", err)
+	}
+}
+
+func TestHandleMountEventRawParameterVersion(t *testing.T) {
+	const parameterVersion = "projects/project/locations/global/parameters/app-config/versions/v1"
+	raw := []byte(`{"db":{"password":"__REF__(//secretmanager.googleapis.com/projects/project/secrets/db/versions/1)"}}`)
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: parameterVersion,
+				FileName:     "rendered.json",
+			},
+			{
+				ResourceName: parameterVersion,
+				FileName:     "raw.json",
+				Render:       proto.Bool(false),
+			},
+			{
+				ResourceName:    parameterVersion,
+				FileName:        "raw-password.txt",
+				ExtractJSONPath: "db.password",
+				Render:          proto.Bool(false),
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	disabled := false
+	pmClient := mockParameterManagerClient(t, &mockParameterManagerServer{
+		renderFn: func(ctx context.Context, req *parametermanagerpb.RenderParameterVersionRequest) (*parametermanagerpb.RenderParameterVersionResponse, error) {
+			return &parametermanagerpb.RenderParameterVersionResponse{
+				ParameterVersion: req.GetName(),
+				RenderedPayload:  []byte(`{"db":{"password":"s3cr3t"}}`),
+			}, nil
+		},
+		getFn: func(ctx context.Context, req *parametermanagerpb.GetParameterVersionRequest) (*parametermanagerpb.ParameterVersion, error) {
+			return &parametermanagerpb.ParameterVersion{
+				Name:     req.GetName(),
+				Disabled: disabled,
+				Payload:  &parametermanagerpb.ParameterVersionPayload{Data: raw},
+			}, nil
+		},
+	})
+	server := &Server{
+		ParameterManagerClient:          pmClient,
+		RegionalParameterManagerClients: staticClients(make(map[string]*parametermanager.Client)),
+		PayloadCache:                    NewPayloadCache(10, time.Minute, 0, 0),
+	}
+
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	want := &v1alpha1.MountResponse{
+		ObjectVersion: []*v1alpha1.ObjectVersion{
+			{Id: parameterVersion, Version: parameterVersion},
+			{Id: parameterVersion, Version: parameterVersion},
+			{Id: parameterVersion, Version: parameterVersion},
+		},
+		Files: []*v1alpha1.File{
+			{Path: "rendered.json", Mode: 777, Contents: []byte(`{"db":{"password":"s3cr3t"}}`)},
+			{Path: "raw.json", Mode: 777, Contents: raw},
+			{Path: "raw-password.txt", Mode: 777, Contents: []byte("__REF__(//secretmanager.googleapis.com/projects/project/secrets/db/versions/1)")},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected response (-want +got):\n%s", diff)
+	}
+
+	disabled = true
+	server.PayloadCache = nil
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil || !strings.Contains(err.Error(), parameterVersion+" is disabled") {
+		t.Errorf("handleMountEvent() got err = %v, want disabled error", err)
+	}
+}
+
+// testTLSBundle returns a root CA certificate and a leaf certificate signed by
+// it together with the SEC 1 encoded private key of the leaf, all PEM encoded.
+func testTLSBundle(t *testing.T) (root, leaf, key []byte) {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, rootKey.Public(), rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		DNSNames:     []string{"app.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, rootTmpl, leafKey.Public(), rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestHandleMountEventPEM(t *testing.T) {
+	root, leaf, key := testTLSBundle(t)
+	keyMode := int32(0400)
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/tls/versions/latest",
+				Path:         "tls",
+				Format:       "pem",
+				KeyFormat:    "pkcs8",
+				Mode:         &keyMode,
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	payload := bytes.Join([][]byte{key, root, leaf}, nil)
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, _ *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    "projects/project/secrets/tls/versions/1",
+				Payload: &secretmanagerpb.SecretPayload{Data: payload},
+			}, nil
+		},
+	})
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+	}
+
+	got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+	}
+	if len(got.Files) != 3 {
+		t.Fatalf("handleMountEvent() got %d files, want 3", len(got.Files))
+	}
+	files := make(map[string]*v1alpha1.File)
+	for _, f := range got.Files {
+		files[f.Path] = f
+	}
+	if f := files["tls/tls.crt"]; f == nil || !bytes.Equal(f.Contents, leaf) {
+		t.Errorf("handleMountEvent() got tls/tls.crt = %v, want the leaf certificate", f)
+	}
+	if f := files["tls/ca.crt"]; f == nil || !bytes.Equal(f.Contents, root) {
+		t.Errorf("handleMountEvent() got tls/ca.crt = %v, want the root certificate", f)
+	}
+	f := files["tls/tls.key"]
+	if f == nil {
+		t.Fatalf("handleMountEvent() got no tls/tls.key")
+	}
+	if block, _ := pem.Decode(f.Contents); block == nil || block.Type != "PRIVATE KEY" {
+		t.Errorf("handleMountEvent() got tls/tls.key = %q, want a PKCS#8 key", f.Contents)
+	}
+	if f.Mode != keyMode {
+		t.Errorf("handleMountEvent() got tls/tls.key mode = %o, want %o", f.Mode, keyMode)
+	}
+
+	// a key which does not belong to the leaf certificate fails the mount
+	_, _, otherKey := testTLSBundle(t)
+	payload = bytes.Join([][]byte{otherKey, root, leaf}, nil)
+	if _, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server); err == nil || !strings.Contains(err.Error(), "private key does not match") {
+		t.Errorf("handleMountEvent() got err = %v, want key mismatch error", err)
+	}
+}
+
+func TestHandleMountEventKeystore(t *testing.T) {
+	root, leaf, key := testTLSBundle(t)
+	keystoreMode := int32(0400)
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/tls/versions/latest",
+				Path:         "tls",
+				Format:       "pem",
+				Alias:        "tls",
+			},
+			{
+				ResourceName: "projects/project/secrets/keystore-password/versions/latest",
+				FileName:     "keystore-password.txt",
+				Alias:        "keystore_password",
+			},
+			{
+				FileName:      "keystore.p12",
+				Format:        "pkcs12",
+				Aliases:       []string{"tls"},
+				PasswordAlias: "keystore_password",
+				Mode:          &keystoreMode,
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	password := "changeit"
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if req.GetName() == "projects/project/secrets/keystore-password/versions/latest" {
+				return &secretmanagerpb.AccessSecretVersionResponse{
+					Name:    "projects/project/secrets/keystore-password/versions/1",
+					Payload: &secretmanagerpb.SecretPayload{Data: []byte(password + "\n")},
+				}, nil
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    "projects/project/secrets/tls/versions/1",
+				Payload: &secretmanagerpb.SecretPayload{Data: bytes.Join([][]byte{leaf, root, key}, nil)},
+			}, nil
+		},
+	})
+	server := &Server{
+		SecretClient:          client,
+		RegionalSecretClients: staticClients(make(map[string]*secretmanager.Client)),
+		Keystores:             NewKeystoreCache(),
+	}
+	mountKeystore := func() *v1alpha1.File {
+		t.Helper()
+		got, err := handleMountEvent(context.Background(), NewFakeCreds(), cfg, server)
+		if err != nil {
+			t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+		}
+		for _, f := range got.Files {
+			if f.Path == "keystore.p12" {
+				return f
+			}
+		}
+		t.Fatalf("handleMountEvent() got no keystore.p12")
+		return nil
+	}
+
+	keystore := mountKeystore()
+	if keystore.Mode != keystoreMode {
+		t.Errorf("handleMountEvent() got keystore.p12 mode = %o, want %o", keystore.Mode, keystoreMode)
+	}
+	_, cert, caCerts, err := pkcs12.DecodeChain(keystore.Contents, "changeit")
+	if err != nil {
+		t.Fatalf("pkcs12.DecodeChain() got err = %v, want err = nil", err)
+	}
+	if got := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); !bytes.Equal(got, leaf) {
+		t.Errorf("handleMountEvent() got keystore certificate %s, want %s", got, leaf)
+	}
+	if len(caCerts) != 1 {
+		t.Errorf("handleMountEvent() got %d CA certificates in the keystore, want 1", len(caCerts))
+	}
+
+	// Unchanged inputs are mounted as the same bytes, so that the file is not
+	// rewritten on every rotation poll.
+	if again := mountKeystore(); !bytes.Equal(again.Contents, keystore.Contents) {
+		t.Errorf("handleMountEvent() rendered different keystore bytes for unchanged inputs")
+	}
+	password = "rotated"
+	rotated := mountKeystore()
+	if bytes.Equal(rotated.Contents, keystore.Contents) {
+		t.Errorf("handleMountEvent() kept the keystore bytes after the password was rotated")
+	}
+	if _, _, _, err := pkcs12.DecodeChain(rotated.Contents, "rotated"); err != nil {
+		t.Errorf("pkcs12.DecodeChain() with the rotated password got err = %v, want err = nil", err)
+	}
+}
+
+// staticClients builds a ClientRegistry which serves the given clients and
+// fails for any other location.
+func staticClients[C io.Closer](clients map[string]C) *ClientRegistry[C] {
+	return NewClientRegistry(func(_ context.Context, location string) (C, error) {
+		if c, ok := clients[location]; ok {
+			return c, nil
+		}
+		var zero C
+		return zero, fmt.Errorf("no client for location %q", location)
+	}, 0)
+}
+
 // mock builds a secretmanager.Client talking to a real in-memory secretmanager
 // GRPC server of the *mockSecretServer.
 func mock(t testing.TB, m *mockSecretServer) *secretmanager.Client {
@@ -1009,6 +2835,9 @@ func mockParameterManagerClient(t testing.TB, m *mockParameterManagerServer) *pa
 type mockSecretServer struct {
 	secretmanagerpb.UnimplementedSecretManagerServiceServer
 	accessFn func(context.Context, *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error)
+	listFn   func(context.Context, *secretmanagerpb.ListSecretsRequest) (*secretmanagerpb.ListSecretsResponse, error)
+	// listVersionsFn stubs ListSecretVersions.
+	listVersionsFn func(context.Context, *secretmanagerpb.ListSecretVersionsRequest) (*secretmanagerpb.ListSecretVersionsResponse, error)
 }
 
 func (s *mockSecretServer) AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
@@ -1018,12 +2847,27 @@ func (s *mockSecretServer) AccessSecretVersion(ctx context.Context, req *secretm
 	return s.accessFn(ctx, req)
 }
 
+func (s *mockSecretServer) ListSecrets(ctx context.Context, req *secretmanagerpb.ListSecretsRequest) (*secretmanagerpb.ListSecretsResponse, error) {
+	if s.listFn == nil {
+		return nil, status.Error(codes.Unimplemented, "mock does not implement listFn")
+	}
+	return s.listFn(ctx, req)
+}
+
+func (s *mockSecretServer) ListSecretVersions(ctx context.Context, req *secretmanagerpb.ListSecretVersionsRequest) (*secretmanagerpb.ListSecretVersionsResponse, error) {
+	if s.listVersionsFn == nil {
+		return nil, status.Error(codes.Unimplemented, "mock does not implement listVersionsFn")
+	}
+	return s.listVersionsFn(ctx, req)
+}
+
 // mockParameterManagerServer matches the parametermanagerpb.ParameterManagerServiceServer
 // interface and allows the RenderParameterVersion implementation to be stubbed
 // with the renderFn function.
 type mockParameterManagerServer struct {
 	parametermanagerpb.UnimplementedParameterManagerServer
 	renderFn func(context.Context, *parametermanagerpb.RenderParameterVersionRequest) (*parametermanagerpb.RenderParameterVersionResponse, error)
+	getFn    func(context.Context, *parametermanagerpb.GetParameterVersionRequest) (*parametermanagerpb.ParameterVersion, error)
 }
 
 func (pm *mockParameterManagerServer) RenderParameterVersion(ctx context.Context, req *parametermanagerpb.RenderParameterVersionRequest) (*parametermanagerpb.RenderParameterVersionResponse, error) {
@@ -1033,6 +2877,120 @@ func (pm *mockParameterManagerServer) RenderParameterVersion(ctx context.Context
 	return pm.renderFn(ctx, req)
 }
 
+func (pm *mockParameterManagerServer) GetParameterVersion(ctx context.Context, req *parametermanagerpb.GetParameterVersionRequest) (*parametermanagerpb.ParameterVersion, error) {
+	if pm.getFn == nil {
+		return nil, status.Error(codes.Unimplemented, "mock does not implement getFn")
+	}
+	return pm.getFn(ctx, req)
+}
+
+// mockKMSClient builds a kms.KeyManagementClient talking to a real in-memory
+// cloudkms GRPC server of the *mockKMSServer.
+func mockKMSClient(t testing.TB, m *mockKMSServer) *kms.KeyManagementClient {
+	t.Helper()
+	l := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	kmspb.RegisterKeyManagementServiceServer(s, m)
+
+	go func() {
+		if err := s.Serve(l); err != nil {
+			t.Errorf("server error: %v", err)
+		}
+	}()
+
+	conn, err := grpc.NewClient("passthrough:whatever", grpc.WithContextDialer(
+		func(context.Context, string) (net.Conn, error) {
+			return l.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	client, err := kms.NewKeyManagementClient(context.Background(), option.WithoutAuthentication(), option.WithGRPCConn(conn))
+	shutdown := func() {
+		t.Log("shutdown called")
+		conn.Close()
+		s.GracefulStop()
+		l.Close()
+	}
+	if err != nil {
+		shutdown()
+		t.Fatal(err)
+	}
+
+	t.Cleanup(shutdown)
+	return client
+}
+
+// mockKMSServer matches the kmspb.KeyManagementServiceServer interface and
+// allows the Decrypt implementation to be stubbed with the decryptFn function.
+type mockKMSServer struct {
+	kmspb.UnimplementedKeyManagementServiceServer
+	decryptFn func(context.Context, *kmspb.DecryptRequest) (*kmspb.DecryptResponse, error)
+}
+
+func (k *mockKMSServer) Decrypt(ctx context.Context, req *kmspb.DecryptRequest) (*kmspb.DecryptResponse, error) {
+	if k.decryptFn == nil {
+		return nil, status.Error(codes.Unimplemented, "mock does not implement decryptFn")
+	}
+	return k.decryptFn(ctx, req)
+}
+
+// mockCAClient builds a privateca.CertificateAuthorityClient talking to a real
+// in-memory privateca GRPC server of the *mockCAServer.
+func mockCAClient(t testing.TB, m *mockCAServer) *privateca.CertificateAuthorityClient {
+	t.Helper()
+	l := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	privatecapb.RegisterCertificateAuthorityServiceServer(s, m)
+
+	go func() {
+		if err := s.Serve(l); err != nil {
+			t.Errorf("server error: %v", err)
+		}
+	}()
+
+	conn, err := grpc.NewClient("passthrough:whatever", grpc.WithContextDialer(
+		func(context.Context, string) (net.Conn, error) {
+			return l.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	client, err := privateca.NewCertificateAuthorityClient(context.Background(), option.WithoutAuthentication(), option.WithGRPCConn(conn))
+	shutdown := func() {
+		t.Log("shutdown called")
+		conn.Close()
+		s.GracefulStop()
+		l.Close()
+	}
+	if err != nil {
+		shutdown()
+		t.Fatal(err)
+	}
+
+	t.Cleanup(shutdown)
+	return client
+}
+
+// mockCAServer matches the privatecapb.CertificateAuthorityServiceServer
+// interface and allows the CreateCertificate implementation to be stubbed with
+// the createCertificateFn function.
+type mockCAServer struct {
+	privatecapb.UnimplementedCertificateAuthorityServiceServer
+	createCertificateFn func(context.Context, *privatecapb.CreateCertificateRequest) (*privatecapb.Certificate, error)
+}
+
+func (c *mockCAServer) CreateCertificate(ctx context.Context, req *privatecapb.CreateCertificateRequest) (*privatecapb.Certificate, error) {
+	if c.createCertificateFn == nil {
+		return nil, status.Error(codes.Unimplemented, "mock does not implement createCertificateFn")
+	}
+	return c.createCertificateFn(ctx, req)
+}
+
 // fakeCreds will adhere to the credentials.PerRPCCredentials interface to add
 // empty credentials on a per-rpc basis.
 type fakeCreds struct{}
@@ -0,0 +1,146 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/infra"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/util"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StorageClient downloads Cloud Storage objects through the JSON API.
+type StorageClient struct {
+	HTTPClient *http.Client
+	// Endpoint is the base URL of the JSON API, e.g.
+	// https://storage.googleapis.com.
+	Endpoint string
+	// MaxObjectSize is the size in bytes above which objects are not
+	// mounted. Zero does not limit the size.
+	MaxObjectSize int64
+}
+
+func (r *resourceFetcher) FetchStorageObjects(ctx context.Context, authOption *gax.CallOption, storageClient *StorageClient, resultChan chan<- *Resource) {
+	fetched, err := r.Fetches.do(r.ResourceURI, func() (*fetchedPayload, error) {
+		payload, generation, err := r.getStorageObject(ctx, storageClient)
+		if err != nil {
+			return r.staleFallback(infra.APICloudStorage, err)
+		}
+		return &fetchedPayload{data: payload, version: generation}, nil
+	})
+	if err != nil {
+		resultChan <- getErrorResource(r.ResourceURI, r.FileName, r.Path, err)
+		return
+	}
+	resource := r.buildResource(ctx, authOption, fetched.data, fetched.version)
+	resource.Stale = fetched.stale
+	resultChan <- resource
+}
+
+// getStorageObject returns the content and generation of the object, from the
+// PayloadCache if possible.
+func (r *resourceFetcher) getStorageObject(ctx context.Context, storageClient *StorageClient) ([]byte, string, error) {
+	if payload, version, ok := r.Cache.get(r.Identity, r.ResourceURI); ok {
+		return payload, version, nil
+	}
+	bucket, object, generation, _ := util.ParseStorageObject(r.ResourceURI)
+	query := url.Values{"alt": {"media"}}
+	if generation != "" {
+		query.Set("generation", generation)
+	}
+	objectURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?%s", strings.TrimSuffix(storageClient.Endpoint, "/"), url.PathEscape(bucket), url.PathEscape(object), query.Encode())
+	if !r.InsecureEndpoints && !strings.HasPrefix(objectURL, "https://") {
+		return nil, "", status.Error(codes.FailedPrecondition, fmt.Sprintf("refusing to send credentials to %s without transport security", storageClient.Endpoint))
+	}
+
+	var payload []byte
+	err := r.Retry.Do(ctx, "GetObject", func() error {
+		release, err := r.Limiter.Acquire(ctx, infra.APICloudStorage)
+		if err != nil {
+			return err
+		}
+		defer release()
+		storageMetricRecorder := csrmetrics.OutboundRPCStartRecorder(r.MetricName)
+		payload, generation, err = r.downloadObject(ctx, storageClient, objectURL)
+		if err != nil {
+			storageMetricRecorder(csrmetrics.OutboundRPCStatus(status.Code(err).String()))
+			return err
+		}
+		storageMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	r.Cache.add(r.Identity, r.ResourceURI, payload, generation)
+	return payload, generation, nil
+}
+
+// downloadObject sends a single media download request authenticated with the
+// credentials of the mount and returns the content and generation of the
+// object.
+func (r *resourceFetcher) downloadObject(ctx context.Context, storageClient *StorageClient, objectURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, objectURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if r.TokenSource == nil {
+		return nil, "", status.Error(codes.Unauthenticated, "unable to obtain credentials: no token source")
+	}
+	token, err := r.TokenSource.Token()
+	if err != nil {
+		return nil, "", status.Error(codes.Unauthenticated, fmt.Sprintf("unable to obtain credentials: %v", err))
+	}
+	token.SetAuthHeader(req)
+	resp, err := storageClient.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", status.Error(codes.Unavailable, fmt.Sprintf("unable to get object: %v", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return nil, "", status.Error(infra.HTTPStatusCode(resp.StatusCode), fmt.Sprintf("unable to get object: %s: %s", resp.Status, strings.TrimSpace(string(body))))
+	}
+
+	maxSize := storageClient.MaxObjectSize
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return nil, "", status.Error(codes.FailedPrecondition, fmt.Sprintf("object size %d bytes exceeds the limit of %d bytes", resp.ContentLength, maxSize))
+	}
+	body := io.Reader(resp.Body)
+	if maxSize > 0 {
+		body = io.LimitReader(resp.Body, maxSize+1)
+	}
+	payload, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", status.Error(codes.Unavailable, fmt.Sprintf("unable to read object: %v", err))
+	}
+	if maxSize > 0 && int64(len(payload)) > maxSize {
+		return nil, "", status.Error(codes.FailedPrecondition, fmt.Sprintf("object size exceeds the limit of %d bytes", maxSize))
+	}
+	generation := resp.Header.Get("X-Goog-Generation")
+	if generation == "" {
+		return nil, "", status.Error(codes.Internal, "response is missing the X-Goog-Generation header")
+	}
+	return payload, generation, nil
+}
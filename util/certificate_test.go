@@ -0,0 +1,64 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewCertificateRequest(t *testing.T) {
+	for _, keyAlgorithm := range []string{"", KeyAlgorithmECDSAP384, KeyAlgorithmRSA2048} {
+		t.Run(keyAlgorithm, func(t *testing.T) {
+			keyPEM, csrPEM, err := NewCertificateRequest(keyAlgorithm, "client", []string{"client.example.com"})
+			if err != nil {
+				t.Fatalf("NewCertificateRequest() got err = %v, want err = nil", err)
+			}
+			keyBlock, _ := pem.Decode(keyPEM)
+			if keyBlock == nil || keyBlock.Type != "PRIVATE KEY" {
+				t.Fatalf("NewCertificateRequest() got key %q, want a PKCS#8 PEM block", keyPEM)
+			}
+			key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			csrBlock, _ := pem.Decode(csrPEM)
+			if csrBlock == nil || csrBlock.Type != "CERTIFICATE REQUEST" {
+				t.Fatalf("NewCertificateRequest() got CSR %q, want a CERTIFICATE REQUEST PEM block", csrPEM)
+			}
+			csr, err := x509.ParseCertificateRequest(csrBlock.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := csr.CheckSignature(); err != nil {
+				t.Errorf("CSR signature is invalid: %v", err)
+			}
+			if csr.Subject.CommonName != "client" || !slices.Equal(csr.DNSNames, []string{"client.example.com"}) {
+				t.Errorf("NewCertificateRequest() got subject %v and DNS names %v", csr.Subject, csr.DNSNames)
+			}
+			if pub, ok := csr.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(key.(crypto.Signer).Public()) {
+				t.Errorf("CSR public key does not match the private key")
+			}
+		})
+	}
+
+	if _, _, err := NewCertificateRequest("dsa", "client", nil); err == nil || !strings.Contains(err.Error(), "unsupported keyAlgorithm value 'dsa'") {
+		t.Errorf("NewCertificateRequest(dsa) got err = %v, want unsupported keyAlgorithm error", err)
+	}
+}
@@ -18,6 +18,7 @@ package util
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	parametermanager "cloud.google.com/go/parametermanager/apiv1"
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
@@ -29,27 +30,37 @@ var newSMRegionalClientFunc = secretmanager.NewClient
 
 var newPMRegionalClientFunc = parametermanager.NewClient
 
-func GetRegionalSecretManagerClient(ctx context.Context, region string, clientOptions []option.ClientOption) *secretmanager.Client {
+// RegionalEndpoint returns the endpoint of location by replacing the
+// {location} placeholder of the endpoint template.
+func RegionalEndpoint(template, location string) string {
+	return strings.ReplaceAll(template, "{location}", location)
+}
+
+// GetRegionalSecretManagerClient returns a Secret Manager client for the
+// regional endpoint of region built from endpointTemplate.
+func GetRegionalSecretManagerClient(ctx context.Context, region, endpointTemplate string, clientOptions []option.ClientOption) (*secretmanager.Client, error) {
 	// See https://pkg.go.dev/cloud.google.com/go#hdr-Client_Options
-	regionalEndpoint := fmt.Sprintf("secretmanager.%s.rep.googleapis.com:443", region)
-	allOpts := append(clientOptions, option.WithEndpoint(regionalEndpoint))
+	regionalEndpoint := RegionalEndpoint(endpointTemplate, region)
+	allOpts := append(clientOptions[:len(clientOptions):len(clientOptions)], option.WithEndpoint(regionalEndpoint))
 	regionalClient, err := newSMRegionalClientFunc(ctx, allOpts...)
 
 	if err != nil {
-		klog.ErrorS(err, "failed to create secret manager client for region", region)
-		return nil
+		klog.ErrorS(err, "failed to create secret manager client for region", "region", region)
+		return nil, fmt.Errorf("failed to create secret manager client for region %s: %w", region, err)
 	}
-	return regionalClient
+	return regionalClient, nil
 }
 
-func GetRegionalParameterManagerClient(ctx context.Context, region string, clientOptions []option.ClientOption) *parametermanager.Client {
+// GetRegionalParameterManagerClient returns a Parameter Manager client for
+// the regional endpoint of region built from endpointTemplate.
+func GetRegionalParameterManagerClient(ctx context.Context, region, endpointTemplate string, clientOptions []option.ClientOption) (*parametermanager.Client, error) {
 	// See https://pkg.go.dev/cloud.google.com/go#hdr-Client_Options
-	regionalEndpoint := fmt.Sprintf("parametermanager.%s.rep.googleapis.com:443", region)
-	allOpts := append(clientOptions, option.WithEndpoint(regionalEndpoint))
+	regionalEndpoint := RegionalEndpoint(endpointTemplate, region)
+	allOpts := append(clientOptions[:len(clientOptions):len(clientOptions)], option.WithEndpoint(regionalEndpoint))
 	regionalClient, err := newPMRegionalClientFunc(ctx, allOpts...)
 	if err != nil {
-		klog.ErrorS(err, "failed to create parameter manager client for region", region)
-		return nil
+		klog.ErrorS(err, "failed to create parameter manager client for region", "region", region)
+		return nil, fmt.Errorf("failed to create parameter manager client for region %s: %w", region, err)
 	}
-	return regionalClient
+	return regionalClient, nil
 }
@@ -83,8 +83,11 @@ func TestGetRegionalSecretManagerClient(t *testing.T) {
 				return secretmanager.NewClient(ctx, option.WithoutAuthentication(), option.WithEndpoint("localhost:1"))
 			}
 
-			client := GetRegionalSecretManagerClient(ctx, tt.region, tt.clientOptions)
+			client, err := GetRegionalSecretManagerClient(ctx, tt.region, "secretmanager.{location}.rep.googleapis.com:443", tt.clientOptions)
 			if tt.wantNil {
+				if err == nil {
+					t.Errorf("GetRegionalSecretManagerClient() with region '%s' returned err = nil, want error", tt.region)
+				}
 				if client != nil {
 					t.Errorf("GetRegionalSecretManagerClient() with region '%s' = non-nil, want nil", tt.region)
 					client.Close() // Attempt to close if unexpectedly non-nil
@@ -95,8 +98,8 @@ func TestGetRegionalSecretManagerClient(t *testing.T) {
 			}
 
 			// If wantNil is false, we expect a non-nil client.
-			if client == nil {
-				t.Fatalf("GetRegionalSecretManagerClient() with region '%s' = nil, want non-nil client. Mock NewClient error: %v", tt.region, tt.newClientErr)
+			if err != nil || client == nil {
+				t.Fatalf("GetRegionalSecretManagerClient() with region '%s' = %v, %v, want non-nil client. Mock NewClient error: %v", tt.region, client, err, tt.newClientErr)
 			}
 
 			// Client is not nil here, so deferring Close is safe.
@@ -172,9 +175,12 @@ func TestGetRegionalParameterManagerClient(t *testing.T) {
 				return parametermanager.NewClient(ctx, option.WithoutAuthentication(), option.WithEndpoint("localhost:1"))
 			}
 
-			client := GetRegionalParameterManagerClient(ctx, tt.region, tt.clientOptions)
+			client, err := GetRegionalParameterManagerClient(ctx, tt.region, "parametermanager.{location}.rep.googleapis.com:443", tt.clientOptions)
 
 			if tt.wantNil {
+				if err == nil {
+					t.Errorf("GetRegionalParameterManagerClient() with region '%s' returned err = nil, want error", tt.region)
+				}
 				if client != nil {
 					t.Errorf("GetRegionalParameterManagerClient() with region '%s' = non-nil, want nil", tt.region)
 					client.Close()
@@ -182,8 +188,8 @@ func TestGetRegionalParameterManagerClient(t *testing.T) {
 				return
 			}
 
-			if client == nil {
-				t.Fatalf("GetRegionalParameterManagerClient() with region '%s' = nil, want non-nil client. Mock NewClient error: %v", tt.region, tt.newClientErr)
+			if err != nil || client == nil {
+				t.Fatalf("GetRegionalParameterManagerClient() with region '%s' = %v, %v, want non-nil client. Mock NewClient error: %v", tt.region, client, err, tt.newClientErr)
 			}
 
 			// Client is not nil here, so deferring Close is safe.
@@ -199,3 +205,38 @@ func TestGetRegionalParameterManagerClient(t *testing.T) {
 		})
 	}
 }
+
+func TestRegionalEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		location string
+		want     string
+	}{
+		{
+			name:     "default template",
+			template: "secretmanager.{location}.rep.googleapis.com:443",
+			location: "us-central1",
+			want:     "secretmanager.us-central1.rep.googleapis.com:443",
+		},
+		{
+			name:     "private service connect",
+			template: "secretmanager-{location}.p.example.internal:443",
+			location: "europe-west1",
+			want:     "secretmanager-europe-west1.p.example.internal:443",
+		},
+		{
+			name:     "template without placeholder",
+			template: "localhost:8080",
+			location: "us-east1",
+			want:     "localhost:8080",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RegionalEndpoint(tt.template, tt.location); got != tt.want {
+				t.Errorf("RegionalEndpoint(%q, %q) = %q, want %q", tt.template, tt.location, got, tt.want)
+			}
+		})
+	}
+}
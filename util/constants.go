@@ -25,4 +25,8 @@ const (
 	globalParameterVersionRegex = "projects/([^/]+)/locations/global/parameters/([^/]+)/versions/([^/]+)$"
 	// #nosec G101 - Not actually hardcoded credentials
 	regionalParameterVersionRegex = "projects/([^/]+)/locations/([^/]+)/parameters/([^/]+)/versions/([^/]+)$"
+	cryptoKeyRegex                = "^projects/([^/]+)/locations/([^/]+)/keyRings/([^/]+)/cryptoKeys/([^/]+)$"
+	storageObjectRegex            = "^projects/_/buckets/([^/]+)/objects/([^#]+)(?:#([0-9]+))?$"
+	caPoolRegex                   = "^projects/([^/]+)/locations/([^/]+)/caPools/([^/]+)$"
+	storageURIRegex               = "^gs://([^/]+)/([^#]+)(?:#([0-9]+))?$"
 )
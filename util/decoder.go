@@ -0,0 +1,85 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Supported values of the decode option of a secret.
+const (
+	DecodeBase64    = "base64"
+	DecodeBase64URL = "base64url"
+	DecodeHex       = "hex"
+	DecodeGzip      = "gzip"
+)
+
+// maxDecompressedSize bounds the size of decompressed payloads, well above
+// what Secret Manager can store, to protect against decompression bombs.
+const maxDecompressedSize = 16 << 20
+
+// Decode decodes payload according to encoding, which is one of base64,
+// base64url, hex or gzip. Whitespace in base64 and around hex payloads is
+// ignored and base64 padding is optional.
+func Decode(payload []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case DecodeBase64:
+		return decodeBase64(payload, base64.StdEncoding, encoding)
+	case DecodeBase64URL:
+		return decodeBase64(payload, base64.URLEncoding, encoding)
+	case DecodeHex:
+		trimmed := bytes.TrimSpace(payload)
+		out := make([]byte, hex.DecodedLen(len(trimmed)))
+		if _, err := hex.Decode(out, trimmed); err != nil {
+			return nil, fmt.Errorf("failed to decode payload as hex: %v", err)
+		}
+		return out, nil
+	case DecodeGzip:
+		r, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode payload as gzip: %v", err)
+		}
+		defer r.Close()
+		out, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode payload as gzip: %v", err)
+		}
+		if len(out) > maxDecompressedSize {
+			return nil, fmt.Errorf("failed to decode payload as gzip: decompressed payload exceeds %d bytes", maxDecompressedSize)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported decode value '%s', must be one of %s, %s, %s or %s", encoding, DecodeBase64, DecodeBase64URL, DecodeHex, DecodeGzip)
+	}
+}
+
+func decodeBase64(payload []byte, encoding *base64.Encoding, name string) ([]byte, error) {
+	// drop line breaks of wrapped base64 output as well
+	trimmed := bytes.Join(bytes.Fields(payload), nil)
+	if len(trimmed)%4 != 0 {
+		encoding = encoding.WithPadding(base64.NoPadding)
+	}
+	out := make([]byte, encoding.DecodedLen(len(trimmed)))
+	n, err := encoding.Decode(out, trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode payload as %s: %v", name, err)
+	}
+	return out[:n], nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       []byte
+		encoding      string
+		want          []byte
+		wantErrSubstr string
+	}{
+		{name: "base64", payload: []byte("aGVsbG8/Pz8="), encoding: DecodeBase64, want: []byte("hello???")},
+		{name: "base64 with trailing newline", payload: []byte("aGVsbG8=\n"), encoding: DecodeBase64, want: []byte("hello")},
+		{name: "base64 wrapped lines", payload: []byte("aGVs\nbG8=\n"), encoding: DecodeBase64, want: []byte("hello")},
+		{name: "base64 without padding", payload: []byte("aGVsbG8"), encoding: DecodeBase64, want: []byte("hello")},
+		{name: "base64url", payload: []byte("aGVsbG8_Pz8="), encoding: DecodeBase64URL, want: []byte("hello???")},
+		{name: "hex", payload: []byte("68656c6c6f\n"), encoding: DecodeHex, want: []byte("hello")},
+		{name: "gzip", payload: gzipped(t, []byte("hello")), encoding: DecodeGzip, want: []byte("hello")},
+		{name: "invalid base64", payload: []byte("not base64!"), encoding: DecodeBase64, wantErrSubstr: "failed to decode payload as base64"},
+		{name: "base64url of base64", payload: []byte("aGVsbG8/Pz8="), encoding: DecodeBase64URL, wantErrSubstr: "failed to decode payload as base64url"},
+		{name: "invalid hex", payload: []byte("zz"), encoding: DecodeHex, wantErrSubstr: "failed to decode payload as hex"},
+		{name: "invalid gzip", payload: []byte("hello"), encoding: DecodeGzip, wantErrSubstr: "failed to decode payload as gzip"},
+		{name: "gzip bomb", payload: gzipped(t, make([]byte, maxDecompressedSize+1)), encoding: DecodeGzip, wantErrSubstr: "decompressed payload exceeds"},
+		{name: "unsupported", payload: []byte("hello"), encoding: "rot13", wantErrSubstr: "unsupported decode value 'rot13'"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Decode(tc.payload, tc.encoding)
+			if tc.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrSubstr) {
+					t.Errorf("Decode() got err = %v, want error containing %q", err, tc.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() got err = %v, want err = nil", err)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("Decode() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// FormatDotenv is the format option of a secret which renders its values as
+// an env file.
+const FormatDotenv = "dotenv"
+
+var (
+	envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// values consisting only of these characters need no quoting in a shell
+	envSafeValueRegexp = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+)
+
+// EnvVar is a variable of an env file.
+type EnvVar struct {
+	Name  string
+	Value []byte
+}
+
+// IsValidEnvName returns true if name can be used as a shell variable name.
+func IsValidEnvName(name string) bool {
+	return envNameRegexp.MatchString(name)
+}
+
+// RenderDotenv renders vars as KEY=value lines which can be sourced by a POSIX
+// shell. Values are single quoted unless they consist only of safe characters,
+// so that whitespace, newlines, '$' and quotes are preserved as is.
+func RenderDotenv(vars []EnvVar) ([]byte, error) {
+	var buf bytes.Buffer
+	names := make(map[string]bool, len(vars))
+	for _, v := range vars {
+		if !IsValidEnvName(v.Name) {
+			return nil, fmt.Errorf("invalid env variable name '%s', names must consist of alphanumeric characters and '_' and not start with a digit", v.Name)
+		}
+		if names[v.Name] {
+			return nil, fmt.Errorf("duplicate env variable name '%s'", v.Name)
+		}
+		names[v.Name] = true
+		if bytes.IndexByte(v.Value, 0) >= 0 {
+			return nil, fmt.Errorf("value of env variable '%s' contains a NUL byte", v.Name)
+		}
+		buf.WriteString(v.Name)
+		buf.WriteByte('=')
+		switch {
+		case len(v.Value) == 0:
+			buf.WriteString("''")
+		case envSafeValueRegexp.Match(v.Value):
+			buf.Write(v.Value)
+		default:
+			buf.WriteByte('\'')
+			buf.Write(bytes.ReplaceAll(v.Value, []byte(`'`), []byte(`'\''`)))
+			buf.WriteByte('\'')
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderDotenv(t *testing.T) {
+	tests := []struct {
+		name          string
+		vars          []EnvVar
+		want          string
+		wantErrSubstr string
+	}{
+		{
+			name: "plain values",
+			vars: []EnvVar{{Name: "DB_USER", Value: []byte("admin")}, {Name: "DB_URL", Value: []byte("postgres://db:5432/app")}},
+			want: "DB_USER=admin\nDB_URL=postgres://db:5432/app\n",
+		},
+		{
+			name: "empty value",
+			vars: []EnvVar{{Name: "EMPTY", Value: nil}},
+			want: "EMPTY=''\n",
+		},
+		{
+			name: "quoted values",
+			vars: []EnvVar{
+				{Name: "SPACES", Value: []byte("a b")},
+				{Name: "DOLLAR", Value: []byte("$HOME`id`")},
+				{Name: "QUOTE", Value: []byte(`it's "x"`)},
+				{Name: "MULTILINE", Value: []byte("line1\nline2")},
+			},
+			want: "SPACES='a b'\nDOLLAR='$HOME`id`'\nQUOTE='it'\\''s \"x\"'\nMULTILINE='line1\nline2'\n",
+		},
+		{
+			name:          "invalid name",
+			vars:          []EnvVar{{Name: "db-password", Value: []byte("x")}},
+			wantErrSubstr: "invalid env variable name 'db-password'",
+		},
+		{
+			name:          "duplicate name",
+			vars:          []EnvVar{{Name: "A", Value: []byte("x")}, {Name: "A", Value: []byte("y")}},
+			wantErrSubstr: "duplicate env variable name 'A'",
+		},
+		{
+			name:          "NUL byte",
+			vars:          []EnvVar{{Name: "A", Value: []byte("x\x00y")}},
+			wantErrSubstr: "contains a NUL byte",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := RenderDotenv(tc.vars)
+			if tc.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrSubstr) {
+					t.Errorf("RenderDotenv() got err = %v, want err containing %q", err, tc.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderDotenv() got err = %v, want err = nil", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("RenderDotenv() got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
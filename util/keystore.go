@@ -0,0 +1,81 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Keystore formats of the format option of a secret.
+const (
+	FormatPKCS12 = "pkcs12"
+	FormatJKS    = "jks"
+)
+
+// JKSKeyAlias is the alias of the private key entry of JKS keystores.
+const JKSKeyAlias = "certificate"
+
+// IsKeystoreFormat returns true if format is one of the keystore formats.
+func IsKeystoreFormat(format string) bool {
+	return format == FormatPKCS12 || format == FormatJKS
+}
+
+// BuildKeystore builds a keystore of the given format, pkcs12 or jks, holding
+// the private key and certificate chain of a PEM bundle protected by password.
+func BuildKeystore(payload []byte, password string, format string) ([]byte, error) {
+	bundle, err := parsePEMBundle(payload)
+	if err != nil {
+		return nil, err
+	}
+	chain := append(bundle.intermediates[:len(bundle.intermediates):len(bundle.intermediates)], bundle.roots...)
+	switch format {
+	case FormatPKCS12:
+		out, err := pkcs12.Modern.Encode(bundle.key, bundle.leaf, chain, password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode PKCS#12 keystore: %v", err)
+		}
+		return out, nil
+	case FormatJKS:
+		key, err := x509.MarshalPKCS8PrivateKey(bundle.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode private key as PKCS#8: %v", err)
+		}
+		// The creation time is taken from the certificate so that the same
+		// inputs yield the same entry.
+		entry := keystore.PrivateKeyEntry{
+			CreationTime: bundle.leaf.NotBefore,
+			PrivateKey:   key,
+		}
+		for _, cert := range append([]*x509.Certificate{bundle.leaf}, chain...) {
+			entry.CertificateChain = append(entry.CertificateChain, keystore.Certificate{Type: "X509", Content: cert.Raw})
+		}
+		ks := keystore.New()
+		if err := ks.SetPrivateKeyEntry(JKSKeyAlias, entry, []byte(password)); err != nil {
+			return nil, fmt.Errorf("failed to build JKS keystore: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := ks.Store(&buf, []byte(password)); err != nil {
+			return nil, fmt.Errorf("failed to encode JKS keystore: %v", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported keystore format '%s', must be one of %s or %s", format, FormatPKCS12, FormatJKS)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestBuildKeystorePKCS12(t *testing.T) {
+	pki := newTestPKI(t)
+	payload := join(pemKey(t, pki.leafKey, true), pki.root, pki.leaf, pki.intermediate)
+
+	out, err := BuildKeystore(payload, "changeit", FormatPKCS12)
+	if err != nil {
+		t.Fatalf("BuildKeystore() got err = %v, want err = nil", err)
+	}
+	key, leaf, caCerts, err := pkcs12.DecodeChain(out, "changeit")
+	if err != nil {
+		t.Fatalf("pkcs12.DecodeChain() got err = %v, want err = nil", err)
+	}
+	if !pki.leafKey.Equal(key) {
+		t.Errorf("BuildKeystore() stored a different private key")
+	}
+	if got := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}); !bytes.Equal(got, pki.leaf) {
+		t.Errorf("BuildKeystore() stored leaf certificate %s, want %s", got, pki.leaf)
+	}
+	if len(caCerts) != 2 {
+		t.Errorf("BuildKeystore() stored %d CA certificates, want 2", len(caCerts))
+	}
+	if _, _, err := pkcs12.Decode(out, "wrong"); err == nil {
+		t.Errorf("pkcs12.Decode() with the wrong password succeeded")
+	}
+}
+
+func TestBuildKeystoreJKS(t *testing.T) {
+	pki := newTestPKI(t)
+	payload := join(pki.leaf, pki.intermediate, pemKey(t, pki.leafKey, false))
+
+	out, err := BuildKeystore(payload, "changeit", FormatJKS)
+	if err != nil {
+		t.Fatalf("BuildKeystore() got err = %v, want err = nil", err)
+	}
+	ks := keystore.New()
+	if err := ks.Load(bytes.NewReader(out), []byte("changeit")); err != nil {
+		t.Fatalf("keystore.Load() got err = %v, want err = nil", err)
+	}
+	entry, err := ks.GetPrivateKeyEntry(JKSKeyAlias, []byte("changeit"))
+	if err != nil {
+		t.Fatalf("GetPrivateKeyEntry() got err = %v, want err = nil", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(entry.PrivateKey)
+	if err != nil {
+		t.Fatalf("x509.ParsePKCS8PrivateKey() got err = %v, want err = nil", err)
+	}
+	if !pki.leafKey.Equal(key) {
+		t.Errorf("BuildKeystore() stored a different private key")
+	}
+	if len(entry.CertificateChain) != 2 {
+		t.Errorf("BuildKeystore() stored a chain of %d certificates, want 2", len(entry.CertificateChain))
+	}
+	leaf, err := x509.ParseCertificate(entry.CertificateChain[0].Content)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate() got err = %v, want err = nil", err)
+	}
+	if !entry.CreationTime.Equal(leaf.NotBefore) {
+		t.Errorf("BuildKeystore() got creation time %v, want the NotBefore %v of the certificate", entry.CreationTime, leaf.NotBefore)
+	}
+}
+
+func TestBuildKeystoreErrors(t *testing.T) {
+	pki := newTestPKI(t)
+	if _, err := BuildKeystore(pki.leaf, "changeit", FormatPKCS12); err == nil || !strings.Contains(err.Error(), "contains no private key") {
+		t.Errorf("BuildKeystore() got err = %v, want missing key error", err)
+	}
+	payload := join(pki.leaf, pemKey(t, pki.leafKey, true))
+	if _, err := BuildKeystore(payload, "changeit", "bks"); err == nil || !strings.Contains(err.Error(), "unsupported keystore format 'bks'") {
+		t.Errorf("BuildKeystore() got err = %v, want unsupported format error", err)
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pathSegment is a single step of an extraction path: either a map key or an
+// array index.
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func (s pathSegment) String() string {
+	if s.isIndex {
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	return s.key
+}
+
+// parsePath parses an extraction path using dot and bracket notation, e.g.
+// "database.primary.password", "hosts[0].cert" or `annotations["a.b/c"]`.
+func parsePath(path string) ([]pathSegment, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	var segments []pathSegment
+	expectKey := true
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			if expectKey {
+				return nil, fmt.Errorf("invalid path '%s': empty key at offset %d", path, i)
+			}
+			expectKey = true
+			i++
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path '%s': unterminated '[' at offset %d", path, i)
+			}
+			inner := path[i+1 : i+end]
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, pathSegment{key: inner[1 : len(inner)-1]})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid path '%s': invalid index '%s'", path, inner)
+				}
+				segments = append(segments, pathSegment{index: index, isIndex: true})
+			}
+			expectKey = false
+			i += end + 1
+		default:
+			if !expectKey {
+				return nil, fmt.Errorf("invalid path '%s': expected '.' or '[' at offset %d", path, i)
+			}
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path) - i
+			}
+			segments = append(segments, pathSegment{key: path[i : i+end]})
+			expectKey = false
+			i += end
+		}
+	}
+	if expectKey {
+		return nil, fmt.Errorf("invalid path '%s': trailing '.'", path)
+	}
+	return segments, nil
+}
+
+// lookupJSONPath walks the decoded JSON data along the segments of path.
+func lookupJSONPath(data any, path string) (any, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	value := data
+	for i, segment := range segments {
+		switch v := value.(type) {
+		case map[string]any:
+			if segment.isIndex {
+				return nil, fmt.Errorf("path '%s' indexes an object with %s in JSON", path, segment)
+			}
+			var ok bool
+			if value, ok = v[segment.key]; !ok {
+				return nil, fmt.Errorf("key '%s' not found at path '%s' in JSON", segment.key, path)
+			}
+		case []any:
+			if !segment.isIndex {
+				return nil, fmt.Errorf("path '%s' looks up key '%s' in an array in JSON", path, segment.key)
+			}
+			if segment.index >= len(v) {
+				return nil, fmt.Errorf("index %d out of range at path '%s' in JSON", segment.index, path)
+			}
+			value = v[segment.index]
+		default:
+			if i == 0 {
+				return nil, fmt.Errorf("path '%s' looks up %s in a scalar JSON document", path, segment)
+			}
+			return nil, fmt.Errorf("path '%s' continues past a scalar value at '%s' in JSON", path, segments[i-1])
+		}
+	}
+	return value, nil
+}
+
+// ExtractContentUsingJSONPath returns the value at path in the JSON payload.
+// Strings are returned as is, numbers and booleans in their JSON
+// representation and objects and arrays as JSON.
+func ExtractContentUsingJSONPath(payload []byte, path string) ([]byte, error) {
+	data, err := decodeJSON(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v. Invalid JSON format for path extraction", err)
+	}
+	value, err := lookupJSONPath(data, path)
+	if err != nil {
+		return nil, err
+	}
+	return renderJSONValue(value, path)
+}
+
+// ExtractContentUsingYAMLPath returns the value at path in the YAML payload.
+// Scalars are returned as written in the payload and mappings and sequences as
+// YAML.
+func ExtractContentUsingYAMLPath(payload []byte, path string) ([]byte, error) {
+	root, err := decodeYAML(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal YAML: %v. Invalid YAML format for path extraction", err)
+	}
+	node, err := lookupYAMLPath(root, path)
+	if err != nil {
+		return nil, err
+	}
+	return renderYAMLNode(node, path)
+}
+
+// ExtractAllKeys returns the value of every top-level key of the JSON or YAML
+// payload, rendered like ExtractContentUsingJSONPath and
+// ExtractContentUsingYAMLPath respectively.
+func ExtractAllKeys(payload []byte) (map[string][]byte, error) {
+	if json.Valid(payload) {
+		data, err := decodeJSON(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %v. Invalid JSON format for key extraction", err)
+		}
+		object, ok := data.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("JSON payload is not an object")
+		}
+		return renderAll(object, renderJSONValue)
+	}
+	root, err := decodeYAML(payload)
+	if err == nil && root.Kind != yaml.MappingNode {
+		err = fmt.Errorf("YAML payload is not a mapping")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %v. Payload must be a JSON object or YAML mapping for key extraction", err)
+	}
+	out := make(map[string][]byte, len(root.Content)/2)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := resolveYAMLAlias(root.Content[i]).Value
+		content, err := renderYAMLNode(root.Content[i+1], key)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = content
+	}
+	return out, nil
+}
+
+// ExtractPaths returns the value at each of paths in the JSON or YAML payload,
+// keyed by path.
+func ExtractPaths(payload []byte, paths []string) (map[string][]byte, error) {
+	extract := ExtractContentUsingYAMLPath
+	if json.Valid(payload) {
+		extract = ExtractContentUsingJSONPath
+	}
+	out := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		content, err := extract(payload, path)
+		if err != nil {
+			return nil, err
+		}
+		out[path] = content
+	}
+	return out, nil
+}
+
+func renderAll(object map[string]any, render func(value any, path string) ([]byte, error)) (map[string][]byte, error) {
+	out := make(map[string][]byte, len(object))
+	for key, value := range object {
+		content, err := render(value, key)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = content
+	}
+	return out, nil
+}
+
+func decodeJSON(payload []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	// keep numbers as written instead of converting them to float64
+	decoder.UseNumber()
+	var data any
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the top-level value")
+	}
+	return data, nil
+}
+
+func renderJSONValue(value any, path string) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, fmt.Errorf("null value at path '%s' in JSON", path)
+	case string:
+		return []byte(v), nil
+	case json.Number:
+		return []byte(v.String()), nil
+	case bool:
+		return []byte(strconv.FormatBool(v)), nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// decodeYAML returns the root node of the YAML payload, so that scalars can be
+// returned as written rather than as re-encoded Go values.
+func decodeYAML(payload []byte) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(payload, &document); err != nil {
+		return nil, err
+	}
+	if document.Kind != yaml.DocumentNode || len(document.Content) == 0 {
+		return nil, fmt.Errorf("empty document")
+	}
+	return resolveYAMLAlias(document.Content[0]), nil
+}
+
+func resolveYAMLAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// lookupYAMLPath walks the YAML node along the segments of path. Mapping keys
+// are matched by their text, whatever their type, e.g. "1" matches the key of
+// "1: one".
+func lookupYAMLPath(root *yaml.Node, path string) (*yaml.Node, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	node := root
+	for i, segment := range segments {
+		switch node.Kind {
+		case yaml.MappingNode:
+			if segment.isIndex {
+				return nil, fmt.Errorf("path '%s' indexes a mapping with %s in YAML", path, segment)
+			}
+			value, ok := lookupYAMLKey(node, segment.key)
+			if !ok {
+				return nil, fmt.Errorf("key '%s' not found at path '%s' in YAML", segment.key, path)
+			}
+			node = value
+		case yaml.SequenceNode:
+			if !segment.isIndex {
+				return nil, fmt.Errorf("path '%s' looks up key '%s' in a sequence in YAML", path, segment.key)
+			}
+			if segment.index >= len(node.Content) {
+				return nil, fmt.Errorf("index %d out of range at path '%s' in YAML", segment.index, path)
+			}
+			node = resolveYAMLAlias(node.Content[segment.index])
+		default:
+			if i == 0 {
+				return nil, fmt.Errorf("path '%s' looks up %s in a scalar YAML document", path, segment)
+			}
+			return nil, fmt.Errorf("path '%s' continues past a scalar value at '%s' in YAML", path, segments[i-1])
+		}
+	}
+	return node, nil
+}
+
+// lookupYAMLKey returns the value of key in the mapping, including the keys
+// merged into it with "<<".
+func lookupYAMLKey(mapping *yaml.Node, key string) (*yaml.Node, bool) {
+	var merged []*yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		k, v := resolveYAMLAlias(mapping.Content[i]), resolveYAMLAlias(mapping.Content[i+1])
+		if k.Tag == "!!merge" {
+			if v.Kind == yaml.SequenceNode {
+				for _, m := range v.Content {
+					merged = append(merged, resolveYAMLAlias(m))
+				}
+			} else {
+				merged = append(merged, v)
+			}
+			continue
+		}
+		if k.Kind == yaml.ScalarNode && k.Value == key {
+			return v, true
+		}
+	}
+	for _, m := range merged {
+		if m.Kind != yaml.MappingNode {
+			continue
+		}
+		if v, ok := lookupYAMLKey(m, key); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// renderYAMLNode returns scalars as written in the payload, e.g. 1000000.0,
+// 0x1F or 2024-01-01, and mappings and sequences as YAML.
+func renderYAMLNode(node *yaml.Node, path string) ([]byte, error) {
+	node = resolveYAMLAlias(node)
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.ShortTag() == "!!null" {
+			return nil, fmt.Errorf("null value at path '%s' in YAML", path)
+		}
+		return []byte(node.Value), nil
+	case yaml.MappingNode, yaml.SequenceNode:
+		if !hasYAMLAlias(node) {
+			return yaml.Marshal(node)
+		}
+		// Aliases would be rendered without the anchors they refer to, so
+		// they are expanded by decoding the node.
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return nil, err
+		}
+		return yaml.Marshal(value)
+	default:
+		return nil, fmt.Errorf("unsupported value at path '%s' in YAML", path)
+	}
+}
+
+func hasYAMLAlias(node *yaml.Node) bool {
+	if node.Kind == yaml.AliasNode {
+		return true
+	}
+	for _, child := range node.Content {
+		if hasYAMLAlias(child) {
+			return true
+		}
+	}
+	return false
+}
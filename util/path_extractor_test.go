@@ -0,0 +1,230 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+const jsonDocument = `{
+	"database": {"primary": {"password": "s3cr3t", "port": 5432, "ratio": 0.5, "tls": true}},
+	"hosts": [{"cert": "cert-0"}, {"cert": "cert-1"}],
+	"annotations": {"example.com/owner": "team-a"},
+	"empty": null
+}`
+
+const yamlDocument = `
+database:
+  primary:
+    password: s3cr3t
+    port: 5432
+    ratio: 0.5
+    tls: true
+hosts:
+  - cert: cert-0
+  - cert: cert-1
+annotations:
+  example.com/owner: team-a
+empty: null
+`
+
+func TestExtractContentUsingJSONPath(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       string
+		path          string
+		want          string
+		wantErrSubstr string
+	}{
+		{name: "nested string", payload: jsonDocument, path: "database.primary.password", want: "s3cr3t"},
+		{name: "array index", payload: jsonDocument, path: "hosts[1].cert", want: "cert-1"},
+		{name: "quoted key", payload: jsonDocument, path: `annotations["example.com/owner"]`, want: "team-a"},
+		{name: "integer", payload: jsonDocument, path: "database.primary.port", want: "5432"},
+		{name: "float", payload: jsonDocument, path: "database.primary.ratio", want: "0.5"},
+		{name: "boolean", payload: jsonDocument, path: "database.primary.tls", want: "true"},
+		{name: "object", payload: jsonDocument, path: "hosts[0]", want: `{"cert":"cert-0"}`},
+		{name: "array", payload: jsonDocument, path: "hosts", want: `[{"cert":"cert-0"},{"cert":"cert-1"}]`},
+		{name: "top level array", payload: `["a", "b"]`, path: "[1]", want: "b"},
+		{name: "null", payload: jsonDocument, path: "empty", wantErrSubstr: "null value at path 'empty'"},
+		{name: "missing key", payload: jsonDocument, path: "database.replica", wantErrSubstr: "key 'replica' not found"},
+		{name: "index out of range", payload: jsonDocument, path: "hosts[2]", wantErrSubstr: "index 2 out of range"},
+		{name: "index into object", payload: jsonDocument, path: "database[0]", wantErrSubstr: "indexes an object"},
+		{name: "key into array", payload: jsonDocument, path: "hosts.cert", wantErrSubstr: "in an array"},
+		{name: "past scalar", payload: jsonDocument, path: "database.primary.password.value", wantErrSubstr: "past a scalar value at 'password'"},
+		{name: "invalid json", payload: `{"a":`, path: "a", wantErrSubstr: "failed to unmarshal JSON"},
+		{name: "trailing data", payload: `{"a":1} garbage`, path: "a", wantErrSubstr: "unexpected data after the top-level value"},
+		{name: "trailing value", payload: `{"a":1}{"a":2}`, path: "a", wantErrSubstr: "unexpected data after the top-level value"},
+		{name: "trailing whitespace", payload: "{\"a\":1}\n", path: "a", want: "1"},
+		{name: "empty path", payload: jsonDocument, path: "", wantErrSubstr: "empty path"},
+		{name: "trailing dot", payload: jsonDocument, path: "database.", wantErrSubstr: "trailing '.'"},
+		{name: "double dot", payload: jsonDocument, path: "database..primary", wantErrSubstr: "empty key"},
+		{name: "unterminated bracket", payload: jsonDocument, path: "hosts[0", wantErrSubstr: "unterminated '['"},
+		{name: "invalid index", payload: jsonDocument, path: "hosts[-1]", wantErrSubstr: "invalid index '-1'"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ExtractContentUsingJSONPath([]byte(tc.payload), tc.path)
+			if tc.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrSubstr) {
+					t.Errorf("ExtractContentUsingJSONPath(%q) got err = %v, want error containing %q", tc.path, err, tc.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractContentUsingJSONPath(%q) got err = %v, want err = nil", tc.path, err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("ExtractContentUsingJSONPath(%q) = %q, want %q", tc.path, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractContentUsingYAMLPath(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       string
+		path          string
+		want          string
+		wantErrSubstr string
+	}{
+		{name: "nested string", payload: yamlDocument, path: "database.primary.password", want: "s3cr3t"},
+		{name: "array index", payload: yamlDocument, path: "hosts[1].cert", want: "cert-1"},
+		{name: "quoted key", payload: yamlDocument, path: `annotations['example.com/owner']`, want: "team-a"},
+		{name: "integer", payload: yamlDocument, path: "database.primary.port", want: "5432"},
+		{name: "float", payload: yamlDocument, path: "database.primary.ratio", want: "0.5"},
+		{name: "boolean", payload: yamlDocument, path: "database.primary.tls", want: "true"},
+		{name: "mapping", payload: yamlDocument, path: "hosts[0]", want: "cert: cert-0\n"},
+		{name: "sequence", payload: yamlDocument, path: "hosts", want: "- cert: cert-0\n- cert: cert-1\n"},
+		{name: "null", payload: yamlDocument, path: "empty", wantErrSubstr: "null value at path 'empty'"},
+		{name: "missing key", payload: yamlDocument, path: "database.replica", wantErrSubstr: "key 'replica' not found"},
+		{name: "scalar document", payload: "just a string", path: "a", wantErrSubstr: "scalar YAML document"},
+		{name: "invalid yaml", payload: "a: [", path: "a", wantErrSubstr: "failed to unmarshal YAML"},
+		{name: "float as written", payload: "a: 1000000.0", path: "a", want: "1000000.0"},
+		{name: "timestamp as written", payload: "a: 2024-01-01", path: "a", want: "2024-01-01"},
+		{name: "hex integer as written", payload: "a: 0x1F", path: "a", want: "0x1F"},
+		{name: "quoted scalar", payload: `a: "0x1F"`, path: "a", want: "0x1F"},
+		{name: "integer keys", payload: "ports:\n  80: http\n  443: https\n", path: "ports.443", want: "https"},
+		{name: "boolean key", payload: "flags:\n  true: on\n", path: "flags.true", want: "on"},
+		{name: "alias", payload: "base: &base\n  user: admin\ncopy: *base\n", path: "copy.user", want: "admin"},
+		{name: "merge key", payload: "base: &base\n  user: admin\nprod:\n  <<: *base\n  host: db\n", path: "prod.user", want: "admin"},
+		{name: "mapping with alias", payload: "base: &base\n  user: admin\nprod:\n  db: *base\n", path: "prod", want: "db:\n    user: admin\n"},
+		{name: "past scalar", payload: "a: 1", path: "a.b", wantErrSubstr: "past a scalar value at 'a'"},
+		{name: "empty document", payload: "", path: "a", wantErrSubstr: "empty document"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ExtractContentUsingYAMLPath([]byte(tc.payload), tc.path)
+			if tc.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrSubstr) {
+					t.Errorf("ExtractContentUsingYAMLPath(%q) got err = %v, want error containing %q", tc.path, err, tc.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractContentUsingYAMLPath(%q) got err = %v, want err = nil", tc.path, err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("ExtractContentUsingYAMLPath(%q) = %q, want %q", tc.path, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractAllKeys(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       string
+		want          map[string]string
+		wantErrSubstr string
+	}{
+		{
+			name:    "json object",
+			payload: `{"user": "admin", "port": 5432, "tls": {"enabled": true}}`,
+			want:    map[string]string{"user": "admin", "port": "5432", "tls": `{"enabled":true}`},
+		},
+		{
+			name:    "yaml mapping",
+			payload: "user: admin\nport: 5432\ntls:\n  enabled: true\n",
+			want:    map[string]string{"user": "admin", "port": "5432", "tls": "enabled: true\n"},
+		},
+		{
+			name:    "yaml scalars as written",
+			payload: "ratio: 1000000.0\nsince: 2024-01-01\nmask: 0x1F\n",
+			want:    map[string]string{"ratio": "1000000.0", "since": "2024-01-01", "mask": "0x1F"},
+		},
+		{
+			name:    "yaml integer keys",
+			payload: "80: http\n443: https\n",
+			want:    map[string]string{"80": "http", "443": "https"},
+		},
+		{
+			name:          "yaml sequence",
+			payload:       "- a\n- b\n",
+			wantErrSubstr: "YAML payload is not a mapping",
+		},
+		{
+			name:          "json array",
+			payload:       `["a", "b"]`,
+			wantErrSubstr: "JSON payload is not an object",
+		},
+		{
+			name:          "null value",
+			payload:       `{"user": null}`,
+			wantErrSubstr: "null value at path 'user'",
+		},
+		{
+			name:          "plain text",
+			payload:       "not a document",
+			wantErrSubstr: "failed to unmarshal payload",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ExtractAllKeys([]byte(tc.payload))
+			if tc.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrSubstr) {
+					t.Errorf("ExtractAllKeys() got err = %v, want error containing %q", err, tc.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractAllKeys() got err = %v, want err = nil", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Errorf("ExtractAllKeys() returned %d keys, want %d", len(got), len(tc.want))
+			}
+			for key, want := range tc.want {
+				if string(got[key]) != want {
+					t.Errorf("ExtractAllKeys()[%q] = %q, want %q", key, got[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractPaths(t *testing.T) {
+	got, err := ExtractPaths([]byte(yamlDocument), []string{"database.primary.password", "hosts[1].cert"})
+	if err != nil {
+		t.Fatalf("ExtractPaths() got err = %v, want err = nil", err)
+	}
+	if string(got["database.primary.password"]) != "s3cr3t" || string(got["hosts[1].cert"]) != "cert-1" {
+		t.Errorf("ExtractPaths() = %q, want password and cert", got)
+	}
+	if _, err := ExtractPaths([]byte(jsonDocument), []string{"missing"}); err == nil {
+		t.Errorf("ExtractPaths() with missing key got err = nil, want error")
+	}
+}
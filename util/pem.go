@@ -0,0 +1,187 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// FormatPEM is the format option of a secret which splits a PEM bundle into
+// TLS files.
+const FormatPEM = "pem"
+
+// Supported values of the keyFormat option of a secret.
+const (
+	KeyFormatPKCS1 = "pkcs1"
+	KeyFormatPKCS8 = "pkcs8"
+)
+
+// TLSBundle holds the PEM encoded files of a TLS bundle.
+type TLSBundle struct {
+	// Certificate is the leaf certificate followed by its intermediates.
+	Certificate []byte
+	PrivateKey  []byte
+	// CA holds the self-signed certificates of the bundle, if any.
+	CA []byte
+}
+
+// pemBundle is a parsed PEM bundle of a certificate chain and its private key.
+type pemBundle struct {
+	leaf *x509.Certificate
+	// intermediates are the other certificates which are not self-signed, in
+	// the order of the bundle.
+	intermediates []*x509.Certificate
+	roots         []*x509.Certificate
+	keyBlock      *pem.Block
+	key           crypto.Signer
+}
+
+// parsePEMBundle parses a PEM bundle of certificates and a single private key.
+// The certificate matching the private key is the leaf.
+func parsePEMBundle(payload []byte) (*pemBundle, error) {
+	var certs []*x509.Certificate
+	var keyBlock *pem.Block
+	for rest := payload; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse certificate: %v", err)
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			if keyBlock != nil {
+				return nil, fmt.Errorf("PEM bundle contains more than one private key")
+			}
+			keyBlock = block
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, fmt.Errorf("encrypted private keys are not supported")
+		default:
+			return nil, fmt.Errorf("unsupported PEM block type '%s'", block.Type)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("PEM bundle contains no certificate")
+	}
+	if keyBlock == nil {
+		return nil, fmt.Errorf("PEM bundle contains no private key")
+	}
+	key, err := parsePrivateKey(keyBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &pemBundle{keyBlock: keyBlock, key: key}
+	for _, cert := range certs {
+		if pub, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && bundle.leaf == nil && pub.Equal(key.Public()) {
+			bundle.leaf = cert
+		} else if isSelfSigned(cert) {
+			bundle.roots = append(bundle.roots, cert)
+		} else {
+			bundle.intermediates = append(bundle.intermediates, cert)
+		}
+	}
+	if bundle.leaf == nil {
+		return nil, fmt.Errorf("private key does not match any certificate of the PEM bundle")
+	}
+	return bundle, nil
+}
+
+// SplitPEMBundle parses a PEM bundle of certificates and a single private key.
+// The certificate matching the private key is the leaf. The private key is
+// re-encoded in keyFormat, one of pkcs1 or pkcs8, or kept as is if keyFormat
+// is empty.
+func SplitPEMBundle(payload []byte, keyFormat string) (*TLSBundle, error) {
+	bundle, err := parsePEMBundle(payload)
+	if err != nil {
+		return nil, err
+	}
+	out := &TLSBundle{}
+	var chain, ca bytes.Buffer
+	for _, cert := range append([]*x509.Certificate{bundle.leaf}, bundle.intermediates...) {
+		chain.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	}
+	for _, cert := range bundle.roots {
+		ca.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	}
+	out.Certificate = chain.Bytes()
+	if ca.Len() > 0 {
+		out.CA = ca.Bytes()
+	}
+	if out.PrivateKey, err = encodePrivateKey(bundle.keyBlock, bundle.key, keyFormat); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// parsePrivateKey parses a PKCS#1, PKCS#8 or SEC 1 private key.
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// encodePrivateKey PEM encodes key in keyFormat. The original block is kept if
+// keyFormat is empty.
+func encodePrivateKey(block *pem.Block, key crypto.Signer, keyFormat string) ([]byte, error) {
+	switch keyFormat {
+	case "":
+		return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes}), nil
+	case KeyFormatPKCS8:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode private key as PKCS#8: %v", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	case KeyFormatPKCS1:
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("PKCS#1 only supports RSA keys, got %T", key)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), nil
+	default:
+		return nil, fmt.Errorf("unsupported keyFormat value '%s', must be one of %s or %s", keyFormat, KeyFormatPKCS1, KeyFormatPKCS8)
+	}
+}
+
+// isSelfSigned returns true if cert is signed by its own key.
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPKI is a root CA, an intermediate CA and a leaf certificate with an RSA
+// key.
+type testPKI struct {
+	root, intermediate, leaf []byte
+	leafKey                  *rsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, serial int64, cn string, isCA bool, pub crypto.PublicKey, parent *x509.Certificate, signer crypto.Signer) (*x509.Certificate, []byte) {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCert, root := newTestCert(t, 1, "root", true, rootKey.Public(), nil, rootKey)
+	intermediateCert, intermediate := newTestCert(t, 2, "intermediate", true, intermediateKey.Public(), rootCert, rootKey)
+	_, leaf := newTestCert(t, 3, "leaf", false, leafKey.Public(), intermediateCert, intermediateKey)
+	return &testPKI{root: root, intermediate: intermediate, leaf: leaf, leafKey: leafKey}
+}
+
+func pemKey(t *testing.T, key any, pkcs8 bool) []byte {
+	t.Helper()
+	if !pkcs8 {
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key.(*rsa.PrivateKey))})
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestSplitPEMBundle(t *testing.T) {
+	pki := newTestPKI(t)
+	pkcs1 := pemKey(t, pki.leafKey, false)
+	pkcs8 := pemKey(t, pki.leafKey, true)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherCert := newTestCert(t, 4, "other", false, otherKey.Public(), nil, otherKey)
+
+	tests := []struct {
+		name          string
+		payload       []byte
+		keyFormat     string
+		want          *TLSBundle
+		wantErrSubstr string
+	}{
+		{
+			name:    "leaf first",
+			payload: join(pki.leaf, pki.intermediate, pki.root, pkcs1),
+			want:    &TLSBundle{Certificate: join(pki.leaf, pki.intermediate), PrivateKey: pkcs1, CA: pki.root},
+		},
+		{
+			name:    "key first and leaf last",
+			payload: join(pkcs8, pki.root, pki.intermediate, pki.leaf),
+			want:    &TLSBundle{Certificate: join(pki.leaf, pki.intermediate), PrivateKey: pkcs8, CA: pki.root},
+		},
+		{
+			name:    "without root",
+			payload: join(pki.leaf, pki.intermediate, pkcs1),
+			want:    &TLSBundle{Certificate: join(pki.leaf, pki.intermediate), PrivateKey: pkcs1},
+		},
+		{
+			name:      "PKCS#1 to PKCS#8",
+			payload:   join(pki.leaf, pkcs1),
+			keyFormat: KeyFormatPKCS8,
+			want:      &TLSBundle{Certificate: pki.leaf, PrivateKey: pkcs8},
+		},
+		{
+			name:      "PKCS#8 to PKCS#1",
+			payload:   join(pki.leaf, pkcs8),
+			keyFormat: KeyFormatPKCS1,
+			want:      &TLSBundle{Certificate: pki.leaf, PrivateKey: pkcs1},
+		},
+		{
+			name:          "EC key to PKCS#1",
+			payload:       join(otherCert, pemKey(t, otherKey, true)),
+			keyFormat:     KeyFormatPKCS1,
+			wantErrSubstr: "PKCS#1 only supports RSA keys",
+		},
+		{
+			name:          "mismatched key",
+			payload:       join(pki.leaf, pki.intermediate, pemKey(t, otherKey, true)),
+			wantErrSubstr: "private key does not match any certificate",
+		},
+		{
+			name:          "no key",
+			payload:       join(pki.leaf, pki.intermediate),
+			wantErrSubstr: "contains no private key",
+		},
+		{
+			name:          "no certificate",
+			payload:       pkcs1,
+			wantErrSubstr: "contains no certificate",
+		},
+		{
+			name:          "two keys",
+			payload:       join(pki.leaf, pkcs1, pkcs8),
+			wantErrSubstr: "more than one private key",
+		},
+		{
+			name:          "unsupported key format",
+			payload:       join(pki.leaf, pkcs1),
+			keyFormat:     "pkcs12",
+			wantErrSubstr: "unsupported keyFormat value 'pkcs12'",
+		},
+		{
+			name:          "not PEM",
+			payload:       []byte("hello"),
+			wantErrSubstr: "contains no certificate",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SplitPEMBundle(tc.payload, tc.keyFormat)
+			if tc.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrSubstr) {
+					t.Errorf("SplitPEMBundle() got err = %v, want err containing %q", err, tc.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SplitPEMBundle() got err = %v, want err = nil", err)
+			}
+			if !bytes.Equal(got.Certificate, tc.want.Certificate) {
+				t.Errorf("SplitPEMBundle() got certificate\n%s\nwant\n%s", got.Certificate, tc.want.Certificate)
+			}
+			if !bytes.Equal(got.PrivateKey, tc.want.PrivateKey) {
+				t.Errorf("SplitPEMBundle() got private key\n%s\nwant\n%s", got.PrivateKey, tc.want.PrivateKey)
+			}
+			if !bytes.Equal(got.CA, tc.want.CA) {
+				t.Errorf("SplitPEMBundle() got CA\n%s\nwant\n%s", got.CA, tc.want.CA)
+			}
+		})
+	}
+}
@@ -19,6 +19,18 @@ import (
 	"regexp"
 )
 
+var numericVersionRegexp = regexp.MustCompile(`^[0-9]+$`)
+
+// fileNameRegexp matches the keys allowed in Kubernetes Secrets and
+// ConfigMaps, which are also safe to use as file names.
+var fileNameRegexp = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+var cryptoKeyRegexp = regexp.MustCompile(cryptoKeyRegex)
+
+var caPoolRegexp = regexp.MustCompile(caPoolRegex)
+
+var storageObjectRegexps = []*regexp.Regexp{regexp.MustCompile(storageObjectRegex), regexp.MustCompile(storageURIRegex)}
+
 // IsSecretResource returns true/false depending on whether the resource URI satisfies the given
 // globalSecretRegex/regionalizedSecretRegex
 func IsSecretResource(resource string) bool {
@@ -34,3 +46,55 @@ func IsParameterManagerResource(resource string) bool {
 	regionalParameterVersionRegexp := regexp.MustCompile(regionalParameterVersionRegex)
 	return globalParameterVersionRegexp.MatchString(resource) || regionalParameterVersionRegexp.MatchString(resource)
 }
+
+// IsCAPool returns true if the resource URI is a Certificate Authority Service
+// CA pool in the format projects/*/locations/*/caPools/*.
+func IsCAPool(resource string) bool {
+	return caPoolRegexp.MatchString(resource)
+}
+
+// IsStorageObject returns true if the resource URI is a Cloud Storage object,
+// either projects/_/buckets/<bucket>/objects/<object> or gs://<bucket>/<object>,
+// optionally pinned to a generation with a #<generation> suffix.
+func IsStorageObject(resource string) bool {
+	_, _, _, ok := ParseStorageObject(resource)
+	return ok
+}
+
+// ParseStorageObject returns the bucket, object name and generation, which is
+// empty unless pinned, of a Cloud Storage object resource URI.
+func ParseStorageObject(resource string) (bucket, object, generation string, ok bool) {
+	for _, r := range storageObjectRegexps {
+		if m := r.FindStringSubmatch(resource); m != nil {
+			return m[1], m[2], m[3], true
+		}
+	}
+	return "", "", "", false
+}
+
+// IsPinnedSecretVersion returns true if the resource URI is a secret version
+// referenced by its numeric version ID rather than an alias such as 'latest',
+// or a Cloud Storage object pinned to a generation.
+func IsPinnedSecretVersion(resource string) bool {
+	if _, _, generation, ok := ParseStorageObject(resource); ok {
+		return generation != ""
+	}
+	for _, r := range []string{globalSecretRegex, regionalSecretRegex} {
+		if m := regexp.MustCompile(r).FindStringSubmatch(resource); m != nil {
+			return numericVersionRegexp.MatchString(m[len(m)-1])
+		}
+	}
+	return false
+}
+
+// IsValidFileName returns true if name can be used as the name of a file
+// written into the mount, i.e. it is a single path element which is not '.' or
+// '..'.
+func IsValidFileName(name string) bool {
+	return fileNameRegexp.MatchString(name) && name != "." && name != ".."
+}
+
+// IsCryptoKey returns true if the resource URI is a Cloud KMS CryptoKey.
+func IsCryptoKey(resource string) bool {
+	return cryptoKeyRegexp.MatchString(resource)
+}
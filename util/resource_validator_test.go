@@ -150,3 +150,150 @@ func TestIsParameterManagerResource(t *testing.T) {
 		})
 	}
 }
+
+func TestIsPinnedSecretVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		want     bool
+	}{
+		{
+			name:     "global secret specific version",
+			resource: "projects/my-project/secrets/my-secret/versions/7",
+			want:     true,
+		},
+		{
+			name:     "regional secret specific version",
+			resource: "projects/my-project/locations/us-central1/secrets/my-secret/versions/12",
+			want:     true,
+		},
+		{
+			name:     "global secret latest version",
+			resource: "projects/my-project/secrets/my-secret/versions/latest",
+			want:     false,
+		},
+		{
+			name:     "regional secret version alias",
+			resource: "projects/my-project/locations/us-central1/secrets/my-secret/versions/prod",
+			want:     false,
+		},
+		{
+			name:     "parameter version",
+			resource: "projects/my-project/locations/global/parameters/my-param/versions/1",
+			want:     false,
+		},
+		{
+			name:     "storage object generation",
+			resource: "gs://my-bucket/config.yaml#1712",
+			want:     true,
+		},
+		{
+			name:     "storage object live generation",
+			resource: "projects/_/buckets/my-bucket/objects/config.yaml",
+			want:     false,
+		},
+		{
+			name:     "empty string",
+			resource: "",
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPinnedSecretVersion(tt.resource); got != tt.want {
+				t.Errorf("IsPinnedSecretVersion(%q) = %v, want %v", tt.resource, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsValidFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "password", want: true},
+		{name: "tls.crt", want: true},
+		{name: "DB_USER-1", want: true},
+		{name: "", want: false},
+		{name: ".", want: false},
+		{name: "..", want: false},
+		{name: "a/b", want: false},
+		{name: "with space", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidFileName(tt.name); got != tt.want {
+				t.Errorf("IsValidFileName(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCryptoKey(t *testing.T) {
+	tests := []struct {
+		resource string
+		want     bool
+	}{
+		{resource: "projects/project/locations/global/keyRings/ring/cryptoKeys/key", want: true},
+		{resource: "projects/project/locations/us-central1/keyRings/ring/cryptoKeys/key", want: true},
+		{resource: "projects/project/locations/global/keyRings/ring/cryptoKeys/key/cryptoKeyVersions/1", want: false},
+		{resource: "projects/project/secrets/test/versions/latest", want: false},
+		{resource: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resource, func(t *testing.T) {
+			if got := IsCryptoKey(tt.resource); got != tt.want {
+				t.Errorf("IsCryptoKey(%q) = %v, want %v", tt.resource, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCAPool(t *testing.T) {
+	tests := []struct {
+		resource string
+		want     bool
+	}{
+		{resource: "projects/project/locations/us-central1/caPools/pool", want: true},
+		{resource: "projects/project/locations/us-central1/caPools/pool/certificateAuthorities/ca", want: false},
+		{resource: "projects/project/locations/us-central1/certificateTemplates/template", want: false},
+		{resource: "projects/project/secrets/test/versions/latest", want: false},
+		{resource: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resource, func(t *testing.T) {
+			if got := IsCAPool(tt.resource); got != tt.want {
+				t.Errorf("IsCAPool(%q) = %v, want %v", tt.resource, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStorageObject(t *testing.T) {
+	tests := []struct {
+		resource       string
+		wantBucket     string
+		wantObject     string
+		wantGeneration string
+		wantOK         bool
+	}{
+		{resource: "gs://bucket/license.txt", wantBucket: "bucket", wantObject: "license.txt", wantOK: true},
+		{resource: "gs://bucket/dir/license.txt#1712", wantBucket: "bucket", wantObject: "dir/license.txt", wantGeneration: "1712", wantOK: true},
+		{resource: "projects/_/buckets/bucket/objects/dir/config.yaml", wantBucket: "bucket", wantObject: "dir/config.yaml", wantOK: true},
+		{resource: "projects/_/buckets/bucket/objects/config.yaml#3", wantBucket: "bucket", wantObject: "config.yaml", wantGeneration: "3", wantOK: true},
+		{resource: "gs://bucket", wantOK: false},
+		{resource: "gs://bucket/", wantOK: false},
+		{resource: "gs://bucket/object#latest", wantOK: false},
+		{resource: "projects/project/buckets/bucket/objects/object", wantOK: false},
+		{resource: "projects/project/secrets/test/versions/latest", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resource, func(t *testing.T) {
+			bucket, object, generation, ok := ParseStorageObject(tt.resource)
+			if ok != tt.wantOK || bucket != tt.wantBucket || object != tt.wantObject || generation != tt.wantGeneration {
+				t.Errorf("ParseStorageObject(%q) = %q, %q, %q, %v, want %q, %q, %q, %v", tt.resource, bucket, object, generation, ok, tt.wantBucket, tt.wantObject, tt.wantGeneration, tt.wantOK)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
 type EnvVar struct {
@@ -53,6 +54,20 @@ func (ev EnvVar) GetValue() (string, error) {
 	return ev.defaultValue, nil
 }
 
+// GetUniverseValue returns the value like GetValue, with the
+// {universe_domain} placeholder replaced by the configured UniverseDomain.
+func (ev EnvVar) GetUniverseValue() (string, error) {
+	value, err := ev.GetValue()
+	if err != nil {
+		return "", err
+	}
+	universeDomain, err := UniverseDomain.GetValue()
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(value, "{universe_domain}", universeDomain), nil
+}
+
 func (ev EnvVar) GetBooleanValue() (bool, error) {
 	oEnvValue, isPresent := os.LookupEnv(ev.envVarName)
 
@@ -76,13 +91,21 @@ func (ev EnvVar) GetBooleanValue() (bool, error) {
 
 var IdentityBindingTokenEndPoint = EnvVar{
 	envVarName:   "GAIA_TOKEN_EXCHANGE_ENDPOINT",
-	defaultValue: "https://securetoken.googleapis.com/v1/identitybindingtoken",
+	defaultValue: "https://securetoken.{universe_domain}/v1/identitybindingtoken",
 	isRequired:   false,
 }
 
 var GkeWorkloadIdentityEndPoint = EnvVar{
 	envVarName:   "GKE_WORKLOAD_IDENTITY_ENDPOINT",
-	defaultValue: "https://container.googleapis.com/v1",
+	defaultValue: "https://container.{universe_domain}/v1",
+	isRequired:   false,
+}
+
+// UniverseDomain is the domain of the Google Cloud universe the provider
+// talks to, which differs from googleapis.com in sovereign clouds.
+var UniverseDomain = EnvVar{
+	envVarName:   "UNIVERSE_DOMAIN",
+	defaultValue: "googleapis.com",
 	isRequired:   false,
 }
 
@@ -121,3 +144,78 @@ var ClusterLocation = EnvVar{
 	defaultValue: "",
 	isRequired:   false,
 }
+
+// SecretManagerEndpoint overrides the global Secret Manager API endpoint,
+// e.g. to use a Private Service Connect hostname or a local emulator.
+var SecretManagerEndpoint = EnvVar{
+	envVarName:   "SECRET_MANAGER_ENDPOINT",
+	defaultValue: "",
+	isRequired:   false,
+}
+
+// SecretManagerRegionalEndpoint is the template of the regional Secret
+// Manager API endpoints. {location} is replaced by the location and
+// {universe_domain} by the UniverseDomain.
+var SecretManagerRegionalEndpoint = EnvVar{
+	envVarName:   "SECRET_MANAGER_REGIONAL_ENDPOINT",
+	defaultValue: "secretmanager.{location}.rep.{universe_domain}:443",
+	isRequired:   false,
+}
+
+// ParameterManagerEndpoint overrides the global Parameter Manager API
+// endpoint.
+var ParameterManagerEndpoint = EnvVar{
+	envVarName:   "PARAMETER_MANAGER_ENDPOINT",
+	defaultValue: "",
+	isRequired:   false,
+}
+
+// ParameterManagerRegionalEndpoint is the template of the regional Parameter
+// Manager API endpoints. {location} is replaced by the location and
+// {universe_domain} by the UniverseDomain.
+var ParameterManagerRegionalEndpoint = EnvVar{
+	envVarName:   "PARAMETER_MANAGER_REGIONAL_ENDPOINT",
+	defaultValue: "parametermanager.{location}.rep.{universe_domain}:443",
+	isRequired:   false,
+}
+
+// CloudKMSEndpoint overrides the Cloud KMS API endpoint used to decrypt
+// payloads.
+var CloudKMSEndpoint = EnvVar{
+	envVarName:   "CLOUD_KMS_ENDPOINT",
+	defaultValue: "",
+	isRequired:   false,
+}
+
+// PrivateCAEndpoint overrides the Certificate Authority Service API endpoint
+// used to issue certificates.
+var PrivateCAEndpoint = EnvVar{
+	envVarName:   "PRIVATECA_ENDPOINT",
+	defaultValue: "",
+	isRequired:   false,
+}
+
+// StorageEndpoint overrides the Cloud Storage JSON API endpoint used to
+// download objects.
+var StorageEndpoint = EnvVar{
+	envVarName:   "STORAGE_ENDPOINT",
+	defaultValue: "",
+	isRequired:   false,
+}
+
+// InsecureEndpoints connects to the Secret Manager and Parameter Manager
+// endpoints, and to the Cloud KMS and Certificate Authority Service endpoints
+// if they are overridden, in plaintext. Only meant for local emulators.
+var InsecureEndpoints = EnvVar{
+	envVarName:   "INSECURE_ENDPOINTS",
+	defaultValue: "false",
+	isRequired:   false,
+}
+
+// ExposePayloadChecksums appends the CRC32C checksum of every mounted payload
+// to its reported version, so that rotations can be audited.
+var ExposePayloadChecksums = EnvVar{
+	envVarName:   "EXPOSE_PAYLOAD_CHECKSUMS",
+	defaultValue: "false",
+	isRequired:   false,
+}
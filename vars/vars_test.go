@@ -130,6 +130,45 @@ func TestGetBooleanValue(t *testing.T) {
 	}
 }
 
+func TestGetUniverseValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      EnvVar
+		want    string
+		envVars map[string]string
+	}{
+		{
+			name: "default universe domain",
+			in:   EnvVar{envVarName: "TEST_ENV_VAR", defaultValue: "https://securetoken.{universe_domain}/v1", isRequired: false},
+			want: "https://securetoken.googleapis.com/v1",
+		},
+		{
+			name:    "configured universe domain",
+			in:      EnvVar{envVarName: "TEST_ENV_VAR", defaultValue: "secretmanager.{location}.rep.{universe_domain}:443", isRequired: false},
+			want:    "secretmanager.{location}.rep.example-universe.com:443",
+			envVars: map[string]string{"UNIVERSE_DOMAIN": "example-universe.com"},
+		},
+		{
+			name:    "env var without placeholder",
+			in:      EnvVar{envVarName: "TEST_ENV_VAR", defaultValue: "https://securetoken.{universe_domain}/v1", isRequired: false},
+			want:    "https://sts.example.internal/v1",
+			envVars: map[string]string{"TEST_ENV_VAR": "https://sts.example.internal/v1", "UNIVERSE_DOMAIN": "example-universe.com"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setTestEnvVars(t, tc.envVars)
+			got, err := tc.in.GetUniverseValue()
+			if err != nil {
+				t.Fatalf("GetUniverseValue(%v) returned an unexpected error: %v", tc.in, err)
+			}
+			if got != tc.want {
+				t.Errorf("GetUniverseValue(%v) = %v, want: %v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
 func TestHasProxyConfigured(t *testing.T) {
 	tests := []struct {
 		name    string